@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// The actions of the entries.
+const (
+	ActionAdd     = "add"
+	ActionAddText = "txt-add"
+	ActionRename  = "rename"
+	ActionSubmit  = "submit"
+	ActionApprove = "approve"
+	ActionReject  = "reject"
+	ActionUndo    = "undo"
+	ActionNSFWOn  = "nsfw-on"
+	ActionNSFWOff = "nsfw-off"
+)
+
+// Entry is a mutation of the sticker library.
+// OldName is empty for new stickers, and NewName is empty for removed ones.
+// Hash is the SHA-256 of the sticker file, which identifies the content even if the file is gone.
+type Entry struct {
+	Action    string    `json:"action"`
+	StickerID string    `json:"sticker_id,omitempty"`
+	OldName   string    `json:"old_name,omitempty"`
+	NewName   string    `json:"new_name,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	ActorID   string    `json:"actor_id"`
+	GuildID   string    `json:"guild_id,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Log keeps the entries in memory and appends every new entry to a JSON lines file.
+// The file is never rewritten.
+type Log struct {
+	mu      sync.Mutex
+	f       *os.File
+	entries []Entry
+}
+
+// Open loads the entries in path and opens it for appending.
+// The file is created if it does not exist.
+func Open(path string) (*Log, error) {
+	l := &Log{}
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for line := 1; sc.Scan(); line++ {
+			var e Entry
+			if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+				// A partial line could be left by a crash. Skip it rather than refusing to start.
+				log.Printf("Skipped a malformed audit entry, path=%s line=%d err=%v\n", path, line, err)
+				continue
+			}
+			l.entries = append(l.entries, e)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	l.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Add appends e to the file.
+func (l *Log) Add(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	l.entries = append(l.entries, e)
+	return nil
+}
+
+// Entries returns the entries for which match returns true, the most recent first.
+func (l *Log) Entries(match func(*Entry) bool) []Entry {
+	return l.EntriesSince(time.Time{}, match)
+}
+
+// EntriesSince is Entries but only returns the entries after since. A zero since returns all entries.
+// The entries are appended in time order, so it stops at the first older entry instead of reading the whole log.
+func (l *Log) EntriesSince(since time.Time, match func(*Entry) bool) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var ret []Entry
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if !since.IsZero() && !l.entries[i].Time.After(since) {
+			break
+		}
+		if match(&l.entries[i]) {
+			ret = append(ret, l.entries[i])
+		}
+	}
+	return ret
+}
+
+// HashFile returns the hex encoded SHA-256 of the file.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func actions(es []Entry) []string {
+	var ret []string
+	for _, e := range es {
+		ret = append(ret, e.Action+":"+e.NewName)
+	}
+	return ret
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, e := range []Entry{
+		{Action: ActionAdd, NewName: "alpha", ActorID: "u1"},
+		{Action: ActionRename, OldName: "alpha", NewName: "bravo", ActorID: "u2"},
+		{Action: ActionAddText, NewName: "charlie", ActorID: "u1"},
+	} {
+		e.Time = t0.Add(time.Duration(i) * time.Minute)
+		if err := l.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	byU1 := func(e *Entry) bool { return e.ActorID == "u1" }
+	want := []string{"txt-add:charlie", "add:alpha"}
+	if got := actions(l.Entries(byU1)); !slices.Equal(got, want) {
+		t.Errorf("Entries() = %v, want %v", got, want)
+	}
+	want = []string{"txt-add:charlie"}
+	if got := actions(l.EntriesSince(t0, byU1)); !slices.Equal(got, want) {
+		t.Errorf("EntriesSince() = %v, want %v", got, want)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A partial line left by a crash is skipped.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"action":"add","new_na` + "\n")
+	f.Close()
+
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	all := l.Entries(func(*Entry) bool { return true })
+	want = []string{"txt-add:charlie", "rename:bravo", "add:alpha"}
+	if got := actions(all); !slices.Equal(got, want) {
+		t.Errorf("after reopening, Entries() = %v, want %v", got, want)
+	}
+	if !all[0].Time.Equal(t0.Add(2 * time.Minute)) {
+		t.Errorf("the time of the latest entry is %v, want %v", all[0].Time, t0.Add(2*time.Minute))
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"; got != want {
+		t.Errorf("HashFile() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"discordsticker/sticker"
+)
+
+// botConfig is the content of the config file. See config.json.example for the supported configs.
+// Every top-level config can also be given by the environment variable DISCORDSTICKER_<NAME>, see applyEnv.
+type botConfig struct {
+	Token string
+	// TokenFile is the file containing the token, e.g. a mounted secret. It cannot be used with Token.
+	TokenFile     string
+	AppID         string
+	CommandPrefix string
+	// CommandPrefixes overrides CommandPrefix with several prefixes.
+	CommandPrefixes []string
+	CoolDown        int
+	// CoolDownMessage is the reply when posting is cooling down. "{remaining}" is replaced with the time left.
+	CoolDownMessage string
+	// CoolDownScope is what a cooldown blocks: "channel", "user", "guild" or "user+channel".
+	CoolDownScope string
+	// CoolDownNotice is how CoolDownMessage is sent: "public", "ephemeral" or "auto-delete".
+	CoolDownNotice string
+	// RateLimit replaces CoolDown if Rate is set. CoolDownScope and CoolDownMessage still apply.
+	RateLimit     rateLimit
+	CaseSensitive bool
+	// Owners are the user IDs which can run every command in every guild.
+	Owners []string
+	// Permissions are the default rules of the commands, keyed by the command names.
+	Permissions map[string]permissionRule
+	// RecentHistorySize is how many recently posted stickers are kept for every user.
+	RecentHistorySize int
+	// PersistRecentHistory keeps the recent history across restarts.
+	PersistRecentHistory bool
+	// UndoWindow is how long in seconds a change can be undone. 0 disables undo.
+	UndoWindow int
+	// DailyQuotaPerUser and DailyQuotaPerGuild limit the number of add, txt-add and rename in 24 hours.
+	// MaxOwnedStickers limits the number of stickers added by a user. 0 means no limit.
+	DailyQuotaPerUser  int
+	DailyQuotaPerGuild int
+	MaxOwnedStickers   int
+	// DiskQuotaMB limits the total size of the sticker files in MiB. 0 means no limit.
+	DiskQuotaMB    int
+	PerGuildConfig []perGuildConfig
+
+	// sources maps the names of the configs to where their values came from, e.g. the environment variable.
+	// The configs not in the map have the default values.
+	sources map[string]string
+}
+
+type perGuildConfig struct {
+	GuildID         string
+	CoolDown        int
+	CoolDownMessage string
+	// CoolDownScope and CoolDownNotice override the top-level ones if not empty.
+	CoolDownScope  string
+	CoolDownNotice string
+	// RateLimit overrides the top-level one if set. {"Rate": 0} goes back to CoolDown.
+	RateLimit   *rateLimit
+	Permissions map[string]permissionRule
+	// ModChannelID enables the approval queue of the guild.
+	ModChannelID string
+	// The quotas of the guild. The top-level ones are used if not set.
+	DailyQuotaPerUser  *int
+	DailyQuotaPerGuild *int
+	// Channels limits the channels of all commands, unless the command has a rule in CommandChannels.
+	Channels        channelRule
+	CommandChannels map[string]channelRule
+	// CommandPrefixes overrides the top-level prefixes in the guild.
+	CommandPrefixes []string
+}
+
+// envPrefix is the prefix of the environment variables of the configs.
+const envPrefix = "DISCORDSTICKER_"
+
+// envName converts the config name to the environment variable, e.g. AppID to DISCORDSTICKER_APP_ID.
+func envName(name string) string {
+	var sb strings.Builder
+	sb.WriteString(envPrefix)
+	rs := []rune(name)
+	for i, r := range rs {
+		// An upper case letter starts a word after a lower case letter, or before one in an acronym like "MB".
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(rs[i-1]) || (i+1 < len(rs) && unicode.IsLower(rs[i+1]))) {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
+
+// rateLimit allows Rate posts in Period seconds, and at most Burst posts at once. Burst defaults to Rate.
+type rateLimit struct {
+	Rate   int
+	Period int
+	Burst  int
+}
+
+func (r rateLimit) enabled() bool { return r.Rate > 0 }
+
+// interval is how long it takes to allow one more post.
+func (r rateLimit) interval() time.Duration {
+	return time.Duration(r.Period) * time.Second / time.Duration(r.Rate)
+}
+
+func (r rateLimit) burst() int {
+	if r.Burst == 0 {
+		return r.Rate
+	}
+	return r.Burst
+}
+
+func (r rateLimit) String() string {
+	if !r.enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%ds burst %d", r.Rate, r.Period, r.burst())
+}
+
+// validate returns the problem of r, or empty if there is none.
+func (r rateLimit) validate() string {
+	if r.Rate < 0 || r.Period < 0 || r.Burst < 0 {
+		return "Rate, Period and Burst must not be negative"
+	}
+	if r.enabled() && r.Period == 0 {
+		return "Period must be set with Rate"
+	}
+	return ""
+}
+
+// readConfig reads the config file at path, applies the environment variables and the token file,
+// and fills the defaults of the missing configs.
+// The precedence is: the environment variables, then the config file, then the defaults.
+// The token is taken from DISCORDSTICKER_TOKEN, then TokenFile (which may also be given by DISCORDSTICKER_TOKEN_FILE), then Token.
+func readConfig(path string) (*botConfig, error) {
+	config := &botConfig{
+		CommandPrefix:     "!!",
+		CoolDown:          5,
+		CoolDownMessage:   "Cooling down...",
+		CoolDownScope:     "channel",
+		CoolDownNotice:    "public",
+		RecentHistorySize: 10,
+		UndoWindow:        600,
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the config file: %w", err)
+	}
+	// Unknown fields are usually typos, which would silently fall back to the defaults.
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the config file: %w", locateJSONError(b, err))
+	}
+	// encoding/json matches the keys case-insensitively, so e.g. "Cooldown" passes the check above.
+	if err := checkKeys(b, reflect.TypeOf(*config), ""); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the config file: %w", err)
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the config file: %w", err)
+	}
+	config.sources = make(map[string]string)
+	for k := range keys {
+		config.sources[k] = "config file"
+	}
+	if config.Token != "" && config.TokenFile != "" {
+		return nil, errors.New("Token and TokenFile cannot be both set in the config file")
+	}
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+	if config.TokenFile != "" && !strings.HasPrefix(config.sources["Token"], "env ") {
+		token, err := os.ReadFile(config.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TokenFile: %w", err)
+		}
+		config.Token = strings.TrimSpace(string(token))
+		config.sources["Token"] = "TokenFile " + config.TokenFile
+	}
+	return config, nil
+}
+
+// applyEnv overrides the top-level configs with the environment variables.
+// The strings are taken as is, and the other values are parsed as JSON, e.g. `10`, `true` or `["!!", "s!"]`.
+func (c *botConfig) applyEnv() error {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := envName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if f.Type.Kind() == reflect.String {
+			v.Field(i).SetString(value)
+		} else {
+			dec := json.NewDecoder(strings.NewReader(value))
+			dec.DisallowUnknownFields()
+			// Decode into a fresh value so that a partial failure does not leave the config half-applied.
+			p := reflect.New(f.Type)
+			if err := dec.Decode(p.Interface()); err != nil {
+				return fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+			if err := checkKeys([]byte(value), f.Type, name); err != nil {
+				return fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+			v.Field(i).Set(p.Elem())
+		}
+		c.sources[f.Name] = "env " + name
+	}
+	return nil
+}
+
+// checkKeys checks that the keys of the JSON objects in b match the field names of t exactly.
+// b must be valid JSON for t. field is the path of b for the error.
+func checkKeys(b []byte, t reflect.Type, field string) error {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return checkKeys(b, t.Elem(), field)
+	case reflect.Slice:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(b, &elems); err != nil {
+			return nil // null
+		}
+		for i, e := range elems {
+			if err := checkKeys(e, t.Elem(), fmt.Sprintf("%s[%d]", field, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		var elems map[string]json.RawMessage
+		if err := json.Unmarshal(b, &elems); err != nil {
+			return nil // null
+		}
+		for _, k := range slices.Sorted(maps.Keys(elems)) {
+			if err := checkKeys(elems[k], t.Elem(), fmt.Sprintf("%s[%q]", field, k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(b, &fields); err != nil {
+			return nil // null
+		}
+		for _, k := range slices.Sorted(maps.Keys(fields)) {
+			path := strings.TrimPrefix(field+"."+k, ".")
+			sf, ok := t.FieldByName(k)
+			if !ok || !sf.IsExported() {
+				for i := 0; i < t.NumField(); i++ {
+					if strings.EqualFold(t.Field(i).Name, k) {
+						return fmt.Errorf("unknown field %s, did you mean %s?", path, t.Field(i).Name)
+					}
+				}
+				return fmt.Errorf("unknown field %s", path)
+			}
+			if err := checkKeys(fields[k], sf.Type, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// locateJSONError adds the line and column in b to the syntax and type errors, which only carry the byte offset.
+func locateJSONError(b []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+	before := b[:min(offset, int64(len(b)))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	// The offset is past the offending byte, so the column counts it.
+	col := len(before) - bytes.LastIndexByte(before, '\n') - 1
+	return fmt.Errorf("line %d column %d: %w", line, col, err)
+}
+
+// isSnowflake reports whether id looks like a Discord ID.
+func isSnowflake(id string) bool {
+	_, err := strconv.ParseUint(id, 10, 64)
+	return err == nil
+}
+
+// checkPrefix returns why p cannot be a command prefix.
+// It's shared by the config file and the prefix setting, so that neither accepts what the other refuses.
+// The setting separates the prefixes by spaces, and the slash commands start with a slash.
+func checkPrefix(p string) error {
+	switch {
+	case p == "":
+		return errors.New("must not be empty")
+	case strings.ContainsFunc(p, unicode.IsSpace):
+		return errors.New("must not contain spaces")
+	case strings.HasPrefix(p, "/"):
+		return errors.New("must not start with a slash")
+	}
+	return nil
+}
+
+// prefixes returns the default command prefixes.
+func (c *botConfig) prefixes() []string {
+	if len(c.CommandPrefixes) != 0 {
+		return c.CommandPrefixes
+	}
+	return []string{c.CommandPrefix}
+}
+
+// checkCommandNames checks that the keys of comms are command names. field is the config name for the error.
+func checkCommandNames[V any](field string, comms map[string]V) error {
+	for comm := range comms {
+		if !slices.Contains(commandNames, comm) {
+			return fmt.Errorf("unknown command %q in %s, expect one of %v", comm, field, commandNames)
+		}
+	}
+	return nil
+}
+
+// validate checks the values which cannot be caught by unmarshaling, and reports all problems found.
+func (c *botConfig) validate() error {
+	var errs []error
+	addErr := func(format string, a ...any) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+	checkIDs := func(field string, ids []string) {
+		for _, id := range ids {
+			if !isSnowflake(id) {
+				addErr("%s: %q is not a Discord ID", field, id)
+			}
+		}
+	}
+	checkPermissions := func(field string, rules map[string]permissionRule) {
+		if err := checkCommandNames(field, rules); err != nil {
+			errs = append(errs, err)
+		}
+		for _, comm := range slices.Sorted(maps.Keys(rules)) {
+			checkIDs(fmt.Sprintf("%s[%q].Roles", field, comm), rules[comm].Roles)
+			checkIDs(fmt.Sprintf("%s[%q].Users", field, comm), rules[comm].Users)
+		}
+	}
+	checkPrefixes := func(field string, prefixes []string) {
+		for _, p := range prefixes {
+			if err := checkPrefix(p); err != nil {
+				addErr("%s: command prefix %q %v", field, p, err)
+			}
+		}
+	}
+	checkCoolDown := func(field string, coolDown int, message, scope, notice string, limit rateLimit) {
+		if coolDown < 0 {
+			addErr("%sCoolDown must not be negative, got %d", field, coolDown)
+		}
+		if (coolDown > 0 || limit.enabled()) && message == "" {
+			addErr("%sCoolDownMessage must not be empty when CoolDown or RateLimit is set", field)
+		}
+		if scope != "" && !slices.Contains(coolDownScopes, scope) {
+			addErr("%sCoolDownScope must be one of %v, got %q", field, coolDownScopes, scope)
+		}
+		if notice != "" && !slices.Contains(coolDownNotices, notice) {
+			addErr("%sCoolDownNotice must be one of %v, got %q", field, coolDownNotices, notice)
+		}
+	}
+	checkRateLimit := func(field string, r *rateLimit) {
+		if r == nil {
+			return
+		}
+		if problem := r.validate(); problem != "" {
+			addErr("%sRateLimit: %s", field, problem)
+		}
+	}
+
+	if c.Token == "" {
+		addErr("Token must not be empty; Set Token, TokenFile or %s", envName("Token"))
+	}
+	if !isSnowflake(c.AppID) {
+		addErr("AppID: %q is not a Discord ID", c.AppID)
+	}
+	checkPrefixes("CommandPrefixes", c.prefixes())
+	checkCoolDown("", c.CoolDown, c.CoolDownMessage, c.CoolDownScope, c.CoolDownNotice, c.RateLimit)
+	if c.CoolDownScope == "" || c.CoolDownNotice == "" {
+		addErr("CoolDownScope and CoolDownNotice must not be empty")
+	}
+	checkRateLimit("", &c.RateLimit)
+	checkIDs("Owners", c.Owners)
+	checkPermissions("Permissions", c.Permissions)
+	if c.DailyQuotaPerUser < 0 || c.DailyQuotaPerGuild < 0 || c.MaxOwnedStickers < 0 || c.DiskQuotaMB < 0 {
+		addErr("DailyQuotaPerUser, DailyQuotaPerGuild, MaxOwnedStickers and DiskQuotaMB must not be negative")
+	}
+	if c.UndoWindow < 0 {
+		addErr("UndoWindow must not be negative, got %d", c.UndoWindow)
+	}
+	if c.RecentHistorySize < 1 || c.RecentHistorySize > maxButtonsPerMessage {
+		addErr("RecentHistorySize must be between 1 and %d, got %d", maxButtonsPerMessage, c.RecentHistorySize)
+	}
+
+	seen := make(map[string]int)
+	for i, conf := range c.PerGuildConfig {
+		field := fmt.Sprintf("PerGuildConfig[%d]", i)
+		if conf.GuildID != "" {
+			field += fmt.Sprintf(" (guild %s)", conf.GuildID)
+		}
+		field += ": "
+		if !isSnowflake(conf.GuildID) {
+			addErr("%sGuildID: %q is not a Discord ID", field, conf.GuildID)
+		} else if j, ok := seen[conf.GuildID]; ok {
+			addErr("%sGuildID is the same as PerGuildConfig[%d]", field, j)
+		} else {
+			seen[conf.GuildID] = i
+		}
+		limit := c.RateLimit
+		if conf.RateLimit != nil {
+			limit = *conf.RateLimit
+		}
+		checkCoolDown(field, conf.CoolDown, conf.CoolDownMessage, conf.CoolDownScope, conf.CoolDownNotice, limit)
+		checkRateLimit(field, conf.RateLimit)
+		checkPrefixes(field+"CommandPrefixes", conf.CommandPrefixes)
+		checkPermissions(field+"Permissions", conf.Permissions)
+		if conf.ModChannelID != "" && !isSnowflake(conf.ModChannelID) {
+			addErr("%sModChannelID: %q is not a Discord ID", field, conf.ModChannelID)
+		}
+		if (conf.DailyQuotaPerUser != nil && *conf.DailyQuotaPerUser < 0) || (conf.DailyQuotaPerGuild != nil && *conf.DailyQuotaPerGuild < 0) {
+			addErr("%sDailyQuotaPerUser and DailyQuotaPerGuild must not be negative", field)
+		}
+		checkIDs(field+"Channels.Allow", conf.Channels.Allow)
+		checkIDs(field+"Channels.Deny", conf.Channels.Deny)
+		if err := checkCommandNames(field+"CommandChannels", conf.CommandChannels); err != nil {
+			errs = append(errs, err)
+		}
+		for _, comm := range slices.Sorted(maps.Keys(conf.CommandChannels)) {
+			checkIDs(fmt.Sprintf("%sCommandChannels[%q].Allow", field, comm), conf.CommandChannels[comm].Allow)
+			checkIDs(fmt.Sprintf("%sCommandChannels[%q].Deny", field, comm), conf.CommandChannels[comm].Deny)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkResources loads the stickers under root read-only and reports the problems, e.g. duplicate sticker names.
+// It returns the number of stickers found.
+func checkResources(root string, caseSensitive bool) (int, error) {
+	fi, err := os.Stat(root)
+	if err != nil {
+		return 0, err
+	}
+	if !fi.IsDir() {
+		return 0, fmt.Errorf("%s is not a directory", root)
+	}
+	// Without the metadata and pending paths, the manager writes nothing.
+	sm, err := sticker.NewManager(root, sticker.CaseSensitive(caseSensitive))
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	paths := make(map[string]string)
+	for _, s := range sm.Stickers() {
+		if p, ok := paths[s.Name()]; ok {
+			errs = append(errs, fmt.Errorf("%s and %s are both sticker %q", p, s.Path(), s.Name()))
+			continue
+		}
+		paths[s.Name()] = s.Path()
+		switch strings.ToLower(s.Ext()) {
+		case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".txt":
+		default:
+			errs = append(errs, fmt.Errorf("%s is not a supported sticker type", s.Path()))
+		}
+	}
+	return len(sm.Stickers()), errors.Join(errs...)
+}
+
+// guildConfigs converts the config to the default guild config and the per-guild ones.
+func (c *botConfig) guildConfigs() (guildConfig, map[string]guildConfig) {
+	defaultConfig := guildConfig{
+		coolDown:           time.Duration(c.CoolDown) * time.Second,
+		coolDownMessage:    c.CoolDownMessage,
+		coolDownScope:      c.CoolDownScope,
+		coolDownNotice:     c.CoolDownNotice,
+		rateLimit:          c.RateLimit,
+		permissions:        c.Permissions,
+		prefixes:           c.prefixes(),
+		dailyQuotaPerUser:  c.DailyQuotaPerUser,
+		dailyQuotaPerGuild: c.DailyQuotaPerGuild,
+	}
+	perGuild := make(map[string]guildConfig)
+	for _, conf := range c.PerGuildConfig {
+		gConf := guildConfig{
+			coolDown:           time.Duration(conf.CoolDown) * time.Second,
+			coolDownMessage:    conf.CoolDownMessage,
+			coolDownScope:      cmp.Or(conf.CoolDownScope, c.CoolDownScope),
+			coolDownNotice:     cmp.Or(conf.CoolDownNotice, c.CoolDownNotice),
+			rateLimit:          c.RateLimit,
+			permissions:        conf.Permissions,
+			modChannelID:       conf.ModChannelID,
+			dailyQuotaPerUser:  c.DailyQuotaPerUser,
+			dailyQuotaPerGuild: c.DailyQuotaPerGuild,
+			prefixes:           conf.CommandPrefixes,
+			channels:           conf.Channels,
+			commandChannels:    conf.CommandChannels,
+		}
+		if conf.RateLimit != nil {
+			gConf.rateLimit = *conf.RateLimit
+		}
+		if conf.DailyQuotaPerUser != nil {
+			gConf.dailyQuotaPerUser = *conf.DailyQuotaPerUser
+		}
+		if conf.DailyQuotaPerGuild != nil {
+			gConf.dailyQuotaPerGuild = *conf.DailyQuotaPerGuild
+		}
+		perGuild[conf.GuildID] = gConf
+		if _, ok := conf.Permissions["review"]; conf.ModChannelID != "" && !ok {
+			if _, ok := c.Permissions["review"]; !ok {
+				log.Printf("Guild %s has ModChannelID but no `review` rule; Everyone can review, so no sticker will wait for approval", conf.GuildID)
+			}
+		}
+	}
+	return defaultConfig, perGuild
+}
+
+// restartOnlyChanges returns the configs which differ from old but only take effect after a restart.
+// The other configs are applied by reloading the guild configs.
+func (c *botConfig) restartOnlyChanges(old *botConfig) []string {
+	var changed []string
+	for _, f := range []struct {
+		name    string
+		changed bool
+	}{
+		{"Token", c.Token != old.Token},
+		{"AppID", c.AppID != old.AppID},
+		{"CaseSensitive", c.CaseSensitive != old.CaseSensitive},
+		{"RecentHistorySize", c.RecentHistorySize != old.RecentHistorySize},
+		{"PersistRecentHistory", c.PersistRecentHistory != old.PersistRecentHistory},
+		{"UndoWindow", c.UndoWindow != old.UndoWindow},
+		{"MaxOwnedStickers", c.MaxOwnedStickers != old.MaxOwnedStickers},
+		{"DiskQuotaMB", c.DiskQuotaMB != old.DiskQuotaMB},
+	} {
+		if f.changed {
+			changed = append(changed, f.name)
+		}
+	}
+	return changed
+}
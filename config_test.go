@@ -0,0 +1,355 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes the config file content to a temporary file and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadConfig(t *testing.T) {
+	c, err := readConfig(writeConfig(t, `{"Token": "t", "AppID": "123", "CoolDown": 3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "t" || c.CoolDown != 3 || c.CommandPrefix != "!!" || c.CoolDownScope != "channel" || c.RecentHistorySize != 10 {
+		t.Errorf("readConfig() = %+v, want the configs in the file with the defaults", c)
+	}
+	if c.sources["CoolDown"] != "config file" || c.sources["CommandPrefix"] != "" {
+		t.Errorf("the sources are %v, want CoolDown from the config file and CommandPrefix from the defaults", c.sources)
+	}
+	if err := c.validate(); err != nil {
+		t.Errorf("validate() failed: %v", err)
+	}
+}
+
+func TestReadConfigErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		wantErr string
+	}{
+		{`{"Token": "t",}`, "line 1 column 15"},
+		{"{\n  \"CoolDown\": \"5\"\n}", "line 2 column 17"},
+		{`{"CoolDwn": 5}`, "unknown field"},
+		{`{"Cooldown": 5}`, "unknown field Cooldown, did you mean CoolDown?"},
+		{`{"PerGuildConfig": [{"GuildID": "1", "Cooldownmessage": "Wait"}]}`, "unknown field PerGuildConfig[0].Cooldownmessage, did you mean CoolDownMessage?"},
+		{`{"PerGuildConfig": [{"GuildID": "1", "Ratelimit": {"Rate": 1}}]}`, "unknown field PerGuildConfig[0].Ratelimit, did you mean RateLimit?"},
+		{`{"Permissions": {"add": {"roles": ["1"]}}}`, `unknown field Permissions["add"].roles, did you mean Roles?`},
+		{`{"sources": {}}`, "unknown field"},
+		{`{"Token": "t", "TokenFile": "f"}`, "Token and TokenFile cannot be both set"},
+	}
+	for _, tc := range tests {
+		_, err := readConfig(writeConfig(t, tc.content))
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("readConfig(%s) = %v, want an error containing %q", tc.content, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	validConfig := func() *botConfig {
+		return &botConfig{
+			Token:             "t",
+			AppID:             "123",
+			CommandPrefix:     "!!",
+			CoolDown:          5,
+			CoolDownMessage:   "Cooling down...",
+			CoolDownScope:     "channel",
+			CoolDownNotice:    "public",
+			RecentHistorySize: 10,
+		}
+	}
+	negative := -1
+	tests := []struct {
+		name   string
+		modify func(c *botConfig)
+		// wantErrs are substrings of the error, or nil if the config is valid.
+		wantErrs []string
+	}{
+		{name: "valid", modify: func(c *botConfig) {}},
+		{
+			name: "valid per-guild config",
+			modify: func(c *botConfig) {
+				c.PerGuildConfig = []perGuildConfig{{
+					GuildID:         "1",
+					CoolDown:        3,
+					CoolDownMessage: "Wait",
+					CoolDownScope:   "user",
+					Permissions:     map[string]permissionRule{"add": {Roles: []string{"2"}}},
+					ModChannelID:    "3",
+					Channels:        channelRule{Allow: []string{"4"}},
+					CommandChannels: map[string]channelRule{"post": {Deny: []string{"5"}}},
+				}}
+			},
+		},
+		{
+			name:     "empty token",
+			modify:   func(c *botConfig) { c.Token = "" },
+			wantErrs: []string{"Token must not be empty; Set Token, TokenFile or DISCORDSTICKER_TOKEN"},
+		},
+		{
+			name: "bad values",
+			modify: func(c *botConfig) {
+				c.AppID = "app"
+				c.CoolDown = -1
+				c.CoolDownScope = "world"
+				c.Owners = []string{"me"}
+				c.RecentHistorySize = 0
+			},
+			wantErrs: []string{
+				`AppID: "app" is not a Discord ID`,
+				"CoolDown must not be negative",
+				"CoolDownScope must be one of",
+				`Owners: "me" is not a Discord ID`,
+				"RecentHistorySize must be between 1 and 25",
+			},
+		},
+		{
+			name:     "cooldown without message",
+			modify:   func(c *botConfig) { c.CoolDownMessage = "" },
+			wantErrs: []string{"CoolDownMessage must not be empty when CoolDown or RateLimit is set"},
+		},
+		{
+			name: "rate limit without message",
+			modify: func(c *botConfig) {
+				c.CoolDown = 0
+				c.CoolDownMessage = ""
+				c.RateLimit = rateLimit{Rate: 1, Period: 5}
+			},
+			wantErrs: []string{"CoolDownMessage must not be empty when CoolDown or RateLimit is set"},
+		},
+		{
+			name:     "rate limit without period",
+			modify:   func(c *botConfig) { c.RateLimit = rateLimit{Rate: 1} },
+			wantErrs: []string{"RateLimit: Period must be set with Rate"},
+		},
+		{
+			name:     "unknown command",
+			modify:   func(c *botConfig) { c.Permissions = map[string]permissionRule{"dance": {}} },
+			wantErrs: []string{`unknown command "dance" in Permissions`},
+		},
+		{
+			name:     "empty prefix",
+			modify:   func(c *botConfig) { c.CommandPrefixes = []string{"!!", ""} },
+			wantErrs: []string{`CommandPrefixes: command prefix "" must not be empty`},
+		},
+		{
+			name:   "prefixes refused by the prefix setting",
+			modify: func(c *botConfig) { c.CommandPrefixes = []string{"/s", "s !"} },
+			wantErrs: []string{
+				`CommandPrefixes: command prefix "/s" must not start with a slash`,
+				`CommandPrefixes: command prefix "s !" must not contain spaces`,
+			},
+		},
+		{
+			name: "bad per-guild configs",
+			modify: func(c *botConfig) {
+				c.PerGuildConfig = []perGuildConfig{
+					{GuildID: "1", CoolDown: 3},
+					{GuildID: "1", DailyQuotaPerUser: &negative},
+					{GuildID: "guild", ModChannelID: "mods"},
+				}
+			},
+			wantErrs: []string{
+				"PerGuildConfig[0] (guild 1): CoolDownMessage must not be empty",
+				"PerGuildConfig[1] (guild 1): GuildID is the same as PerGuildConfig[0]",
+				"PerGuildConfig[1] (guild 1): DailyQuotaPerUser and DailyQuotaPerGuild must not be negative",
+				`PerGuildConfig[2] (guild guild): GuildID: "guild" is not a Discord ID`,
+				`PerGuildConfig[2] (guild guild): ModChannelID: "mods" is not a Discord ID`,
+			},
+		},
+		{
+			name: "per-guild config inheriting the rate limit without message",
+			modify: func(c *botConfig) {
+				c.RateLimit = rateLimit{Rate: 1, Period: 5}
+				c.PerGuildConfig = []perGuildConfig{{GuildID: "1"}}
+			},
+			wantErrs: []string{"PerGuildConfig[0] (guild 1): CoolDownMessage must not be empty when CoolDown or RateLimit is set"},
+		},
+		{
+			name: "per-guild config turning off the rate limit",
+			modify: func(c *botConfig) {
+				c.RateLimit = rateLimit{Rate: 1, Period: 5}
+				c.PerGuildConfig = []perGuildConfig{{GuildID: "1", RateLimit: &rateLimit{}}}
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := validConfig()
+			tc.modify(c)
+			err := c.validate()
+			if len(tc.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validate() = nil, want errors containing %q", tc.wantErrs)
+			}
+			for _, want := range tc.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validate() = %v, want an error containing %q", err, want)
+				}
+			}
+			if got := strings.Count(err.Error(), "\n") + 1; got != len(tc.wantErrs) {
+				t.Errorf("validate() reported %d problems, want %d:\n%v", got, len(tc.wantErrs), err)
+			}
+		})
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"Token":                "DISCORDSTICKER_TOKEN",
+		"AppID":                "DISCORDSTICKER_APP_ID",
+		"CoolDown":             "DISCORDSTICKER_COOL_DOWN",
+		"DiskQuotaMB":          "DISCORDSTICKER_DISK_QUOTA_MB",
+		"PersistRecentHistory": "DISCORDSTICKER_PERSIST_RECENT_HISTORY",
+	}
+	for name, want := range tests {
+		if got := envName(name); got != want {
+			t.Errorf("envName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestReadConfigEnv(t *testing.T) {
+	t.Setenv("DISCORDSTICKER_APP_ID", "456")
+	t.Setenv("DISCORDSTICKER_COOL_DOWN", "10")
+	t.Setenv("DISCORDSTICKER_COMMAND_PREFIXES", `["!!", "s!"]`)
+	t.Setenv("DISCORDSTICKER_PERMISSIONS", `{"add": {"Roles": ["1"]}}`)
+
+	c, err := readConfig(writeConfig(t, `{"Token": "t", "AppID": "123", "CoolDown": 3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.AppID != "456" || c.CoolDown != 10 || strings.Join(c.CommandPrefixes, " ") != "!! s!" || len(c.Permissions["add"].Roles) != 1 {
+		t.Errorf("readConfig() = %+v, want the environment variables to take precedence", c)
+	}
+	if got, want := c.sources["CoolDown"], "env DISCORDSTICKER_COOL_DOWN"; got != want {
+		t.Errorf("the source of CoolDown is %q, want %q", got, want)
+	}
+}
+
+func TestReadConfigEnvErrors(t *testing.T) {
+	tests := []struct {
+		name, value string
+		wantErr     string
+	}{
+		{"DISCORDSTICKER_COOL_DOWN", "ten", "failed to parse DISCORDSTICKER_COOL_DOWN"},
+		{"DISCORDSTICKER_CASE_SENSITIVE", "yes", "failed to parse DISCORDSTICKER_CASE_SENSITIVE"},
+		{"DISCORDSTICKER_PERMISSIONS", `{"add": {"Rols": ["1"]}}`, "unknown field"},
+		{"DISCORDSTICKER_PERMISSIONS", `{"add": {"roles": ["1"]}}`, `unknown field DISCORDSTICKER_PERMISSIONS["add"].roles, did you mean Roles?`},
+		{"DISCORDSTICKER_RATE_LIMIT", `{"Rate": 3, "Perod": 10}`, "unknown field"},
+		{"DISCORDSTICKER_RATE_LIMIT", `{"rate": 3}`, "unknown field DISCORDSTICKER_RATE_LIMIT.rate, did you mean Rate?"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name+"="+tc.value, func(t *testing.T) {
+			t.Setenv(tc.name, tc.value)
+			_, err := readConfig(writeConfig(t, `{"Token": "t"}`))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("readConfig() = %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadConfigToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		want    string
+		// wantSource is the prefix of the source of the token.
+		wantSource string
+	}{
+		{name: "config file", content: `{"Token": "from-config"}`, want: "from-config", wantSource: "config file"},
+		{name: "token file", content: `{"TokenFile": "` + tokenFile + `"}`, want: "from-file", wantSource: "TokenFile"},
+		{
+			name:       "token file from env",
+			content:    `{"Token": "from-config"}`,
+			env:        map[string]string{"DISCORDSTICKER_TOKEN_FILE": tokenFile},
+			want:       "from-file",
+			wantSource: "TokenFile",
+		},
+		{
+			name:       "env over token file",
+			content:    `{"TokenFile": "` + tokenFile + `"}`,
+			env:        map[string]string{"DISCORDSTICKER_TOKEN": "from-env"},
+			want:       "from-env",
+			wantSource: "env DISCORDSTICKER_TOKEN",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			c, err := readConfig(writeConfig(t, tc.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Token != tc.want || !strings.HasPrefix(c.sources["Token"], tc.wantSource) {
+				t.Errorf("the token is %q from %q, want %q from %q", c.Token, c.sources["Token"], tc.want, tc.wantSource)
+			}
+		})
+	}
+
+	if _, err := readConfig(writeConfig(t, `{"TokenFile": "`+tokenFile+`.missing"}`)); err == nil || !strings.Contains(err.Error(), "failed to read TokenFile") {
+		t.Errorf("readConfig() with a missing token file = %v, want an error", err)
+	}
+}
+
+func TestRestartOnlyChanges(t *testing.T) {
+	old, err := readConfig(writeConfig(t, `{"Token": "t", "CoolDown": 3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := readConfig(writeConfig(t, `{"Token": "u", "CoolDown": 5, "UndoWindow": 60}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := next.restartOnlyChanges(old), []string{"Token", "UndoWindow"}; !slices.Equal(got, want) {
+		t.Errorf("restartOnlyChanges() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckResources(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"alpha.png", "a/b.txt", "a-b.gif", "notes.md"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := checkResources(root, false)
+	if n != 4 || err == nil {
+		t.Fatalf("checkResources() = %d, %v; want 4 stickers with errors", n, err)
+	}
+	for _, want := range []string{`are both sticker "a-b"`, "notes.md is not a supported sticker type"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("checkResources() = %v, want an error containing %q", err, want)
+		}
+	}
+}
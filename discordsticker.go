@@ -1,22 +1,31 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
+	"math"
 	"math/rand"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unicode"
 
+	"discordsticker/audit"
+	"discordsticker/imaging"
+	"discordsticker/stats"
 	"discordsticker/sticker"
+	"discordsticker/userdata"
 	"discordsticker/utils"
 
 	"github.com/bwmarrin/discordgo"
@@ -24,53 +33,349 @@ import (
 
 const maxMsgLen = 2000
 
-var (
-	// server configs
-	commandPrefix string
-)
+// commandNames are the commands which can be given to the bot.
+var commandNames = []string{"help", "list", "categories", "add", "txt-add", "rename", "random", "combo", "stats", "top", "recent", "fav", "history", "undo", "usage", "nsfw", "config", "post", "review", "undo-any"}
+
+// actionNames are the entries of commandNames which have no command form and only exist for the permissions.
+// "post" is the command without name, e.g. `!!<pattern>`, and the sticker buttons.
+// "review" is approving or rejecting the pending stickers; The users allowed to review skip the approval queue.
+// "undo-any" is undoing the changes of the other users.
+var actionNames = []string{"post", "review", "undo-any"}
+
+// ownerOnlyByDefault are the commands which only the owners can run if there is no rule.
+var ownerOnlyByDefault = []string{"undo-any", "nsfw", "config"}
+
+// permissionRule lists who can run a command.
+// A user is allowed if the user ID is in Users or the user has any role in Roles.
+type permissionRule struct {
+	Roles []string
+	Users []string
+}
+
+func (r permissionRule) allows(userID string, roles []string) bool {
+	if slices.Contains(r.Users, userID) {
+		return true
+	}
+	for _, role := range roles {
+		if slices.Contains(r.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// channelRule limits the channels where the commands can be run.
+// Empty Allow means every channel not in Deny.
+type channelRule struct {
+	Allow []string
+	Deny  []string
+}
+
+func (r channelRule) allows(channelID string) bool {
+	if slices.Contains(r.Deny, channelID) {
+		return false
+	}
+	return len(r.Allow) == 0 || slices.Contains(r.Allow, channelID)
+}
+
+// coolDownNotices are the values of CoolDownNotice, which decide how the users are told about the cooldown.
+// "ephemeral" only shows the notice to the user, which is not possible for the text commands; They fall back to "auto-delete".
+// "auto-delete" deletes the notice when the cooldown ends.
+var coolDownNotices = []string{"public", "ephemeral", "auto-delete"}
+
+// minCoolDownNoticeLife is how long an auto-deleted notice lives at least, so that it can be read.
+const minCoolDownNoticeLife = 5 * time.Second
+
+// coolDownScopes are the values of CoolDownScope, which decide what a cooldown blocks.
+// "user" blocks the user in the whole guild, and "user+channel" blocks the user in the channel only.
+var coolDownScopes = []string{"channel", "user", "guild", "user+channel"}
 
 type guildConfig struct {
 	coolDown        time.Duration
 	coolDownMessage string
+	// coolDownScope is one of coolDownScopes.
+	coolDownScope string
+	// rateLimit replaces coolDown if enabled.
+	rateLimit rateLimit
+	// coolDownNotice is one of coolDownNotices.
+	coolDownNotice string
+	// permissions maps the command names to the rules. See hasPermission for the commands without a rule.
+	permissions map[string]permissionRule
+	// modChannelID is the channel to review the new stickers. Empty means the stickers go live immediately.
+	modChannelID string
+	// dailyQuotaPerUser and dailyQuotaPerGuild limit the number of add, txt-add and rename in a day. 0 means no limit.
+	dailyQuotaPerUser  int
+	dailyQuotaPerGuild int
+	// prefixes are the prefixes of the text commands. The first one is shown in the help.
+	prefixes []string
+	// channels applies to the commands without a rule in commandChannels.
+	channels        channelRule
+	commandChannels map[string]channelRule
 }
 
 type guildConfigManager struct {
 	defaultConfig  guildConfig
 	perGuildConfig map[string]guildConfig
-	cdCounter      *utils.CoolDownCounter
+	// overrides are the settings changed at runtime, which take precedence over perGuildConfig.
+	overrides *guildOverrides
+	owners    []string
+	cdCounter *utils.CoolDownCounter
+	limiter   *utils.RateLimiter
 }
 
-func newGuildConfigManager(defaultConfig guildConfig, perGuildConfig map[string]guildConfig) *guildConfigManager {
+// newGuildConfigManager creates the manager. The manager is immutable; Reloading the config creates a new one
+// sharing overrides, cdCounter and limiter with the old one.
+func newGuildConfigManager(defaultConfig guildConfig, perGuildConfig map[string]guildConfig, overrides *guildOverrides, owners []string, cdCounter *utils.CoolDownCounter, limiter *utils.RateLimiter) *guildConfigManager {
 	return &guildConfigManager{
 		defaultConfig:  defaultConfig,
 		perGuildConfig: perGuildConfig,
-		cdCounter:      utils.NewCoolDownCounter(),
+		overrides:      overrides,
+		owners:         owners,
+		cdCounter:      cdCounter,
+		limiter:        limiter,
 	}
 }
 
-func (gc *guildConfigManager) tryCoolDown(channelID, guildID string) (bool, string) {
-	if guildID == "" {
-		return true, ""
+// guildConf returns the config of the guild with the overrides applied.
+// ok is false if the guild has neither config nor overrides, in which case the default config applies.
+// A guild with overrides but no config inherits the cooldown and the quotas of the default config.
+func (gc *guildConfigManager) guildConf(guildID string) (c guildConfig, ok bool) {
+	c, ok = gc.perGuildConfig[guildID]
+	o, found := gc.overrides.get(guildID)
+	if !found {
+		if !ok {
+			return gc.defaultConfig, false
+		}
+		return c, true
 	}
-	conf := gc.defaultConfig
+	return o.apply(gc.baseConf(guildID)), true
+}
+
+// baseConf returns the config the overrides of the guild are applied to.
+func (gc *guildConfigManager) baseConf(guildID string) guildConfig {
 	if c, ok := gc.perGuildConfig[guildID]; ok {
-		conf = c
+		return c
+	}
+	return guildConfig{
+		coolDown:           gc.defaultConfig.coolDown,
+		coolDownMessage:    gc.defaultConfig.coolDownMessage,
+		coolDownScope:      gc.defaultConfig.coolDownScope,
+		rateLimit:          gc.defaultConfig.rateLimit,
+		coolDownNotice:     gc.defaultConfig.coolDownNotice,
+		dailyQuotaPerUser:  gc.defaultConfig.dailyQuotaPerUser,
+		dailyQuotaPerGuild: gc.defaultConfig.dailyQuotaPerGuild,
+	}
+}
+
+// hasPermission reports whether the user of h can run command.
+// The owners can run every command. The rule in the guild config takes precedence over the default one.
+// Commands without a rule are open to everyone, except ownerOnlyByDefault.
+func (gc *guildConfigManager) hasPermission(h handler, command string) bool {
+	if slices.Contains(gc.owners, h.userID()) {
+		return true
+	}
+	rule, ok := gc.defaultConfig.permissions[command]
+	if c, found := gc.guildConf(h.guildID()); found {
+		if r, found := c.permissions[command]; found {
+			rule, ok = r, true
+		}
+	}
+	if !ok {
+		return !slices.Contains(ownerOnlyByDefault, command)
+	}
+	return rule.allows(h.userID(), h.memberRoles())
+}
+
+// prefixes returns the command prefixes of the guild.
+func (gc *guildConfigManager) prefixes(guildID string) []string {
+	if c, ok := gc.guildConf(guildID); ok && len(c.prefixes) != 0 {
+		return c.prefixes
+	}
+	return gc.defaultConfig.prefixes
+}
+
+// matchPrefix returns the longest prefix of the guild that content starts with.
+func (gc *guildConfigManager) matchPrefix(guildID, content string) (string, bool) {
+	matched := ""
+	for _, p := range gc.prefixes(guildID) {
+		if strings.HasPrefix(content, p) && len(p) > len(matched) {
+			matched = p
+		}
+	}
+	return matched, matched != ""
+}
+
+// quotas returns the daily quotas per user and per guild in the guild.
+func (gc *guildConfigManager) quotas(guildID string) (int, int) {
+	conf, _ := gc.guildConf(guildID)
+	return conf.dailyQuotaPerUser, conf.dailyQuotaPerGuild
+}
+
+// reviewChannel returns the mod channel if the stickers added by the user of h need approval, or empty otherwise.
+func (gc *guildConfigManager) reviewChannel(h handler) string {
+	c, ok := gc.guildConf(h.guildID())
+	if !ok || c.modChannelID == "" || gc.hasPermission(h, "review") {
+		return ""
+	}
+	return c.modChannelID
+}
+
+// allowedIn reports whether command can be run in the channel of the guild.
+// DMs are not limited.
+func (gc *guildConfigManager) allowedIn(guildID, channelID, command string) bool {
+	c, ok := gc.guildConf(guildID)
+	if !ok {
+		return true
+	}
+	if r, ok := c.commandChannels[command]; ok {
+		return r.allows(channelID)
+	}
+	return c.channels.allows(channelID)
+}
+
+// checkCommand checks whether the user of h can run command in the channel, and informs the user on denial.
+// It's consulted before dispatching every command.
+func (gc *guildConfigManager) checkCommand(h handler, command string) bool {
+	if !gc.allowedIn(h.guildID(), h.channelID(), command) {
+		log.Printf("%s is denied to run `%s` in channel %s", h.userInfo(), command, h.channelID())
+		h.replyPrivate(fmt.Sprintf("`%s` is not allowed in this channel.", command))
+		return false
+	}
+	return gc.checkPermission(h, command)
+}
+
+// checkPermission is hasPermission but informs the user on denial.
+func (gc *guildConfigManager) checkPermission(h handler, command string) bool {
+	if gc.hasPermission(h, command) {
+		return true
+	}
+	log.Printf("%s is denied to run `%s`", h.userInfo(), command)
+	h.replyPrivate(fmt.Sprintf("You don't have the permission to run `%s`.", command))
+	return false
+}
+
+// coolDownKey identifies what is cooling down. The fields not covered by the scope are left empty.
+type coolDownKey struct {
+	guildID   string
+	channelID string
+	userID    string
+}
+
+func coolDownKeyOf(h handler, scope string) coolDownKey {
+	switch scope {
+	case "user":
+		return coolDownKey{guildID: h.guildID(), userID: h.userID()}
+	case "guild":
+		return coolDownKey{guildID: h.guildID()}
+	case "user+channel":
+		return coolDownKey{channelID: h.channelID(), userID: h.userID()}
+	default:
+		return coolDownKey{channelID: h.channelID()}
+	}
+}
+
+// tryCoolDown starts the cooldown, or takes a token of the rate limit, for the user of h in the scope configured in the guild.
+// It returns false and informs the user if it's already cooling down. DMs never cool down.
+func (gc *guildConfigManager) tryCoolDown(h handler) bool {
+	if h.guildID() == "" {
+		return true
 	}
-	if conf.coolDown == 0 || gc.cdCounter.CoolDown(conf.coolDown, channelID) {
-		return true, ""
+	conf, _ := gc.guildConf(h.guildID())
+	key := coolDownKeyOf(h, conf.coolDownScope)
+	var remaining time.Duration
+	if conf.rateLimit.enabled() {
+		if gc.limiter.Allow(key, conf.rateLimit.interval(), conf.rateLimit.burst()) {
+			return true
+		}
+		remaining = gc.limiter.Remaining(key, conf.rateLimit.interval(), conf.rateLimit.burst())
+	} else {
+		if conf.coolDown == 0 || gc.cdCounter.CoolDown(conf.coolDown, key) {
+			return true
+		}
+		remaining = gc.cdCounter.Remaining(key)
 	}
-	return false, conf.coolDownMessage
+
+	// Round up so that the user never retries too early.
+	remaining = remaining.Truncate(time.Second) + time.Second
+	msg := strings.ReplaceAll(conf.coolDownMessage, "{remaining}", remaining.String())
+	h.replyCoolDown(msg, conf.coolDownNotice, max(remaining, minCoolDownNoticeLife))
+	return false
 }
 
-func (gc *guildConfigManager) removeCoolDown(channelID string) {
-	gc.cdCounter.RemoveCoolDown(channelID)
+// removeCoolDown ends the cooldown, or gives back the token, taken by tryCoolDown.
+func (gc *guildConfigManager) removeCoolDown(h handler) {
+	if h.guildID() == "" {
+		return
+	}
+	conf, _ := gc.guildConf(h.guildID())
+	key := coolDownKeyOf(h, conf.coolDownScope)
+	if conf.rateLimit.enabled() {
+		gc.limiter.Refund(key, conf.rateLimit.interval(), conf.rateLimit.burst())
+		return
+	}
+	gc.cdCounter.RemoveCoolDown(key)
 }
 
 type handler interface {
 	userInfo() string
+	userID() string
+	guildID() string
+	channelID() string
+	// memberRoles returns the role IDs of the user in the guild, or nil in DM.
+	memberRoles() []string
+	// nsfwChannel reports whether the channel is age-restricted.
+	nsfwChannel() bool
 	postSticker(poster io.Reader, ext string) error
 	replyPrivate(msg string)
 	replyPublic(msg string)
+	// replyComponents sends message with components, e.g. buttons, which only the user should act on.
+	replyComponents(msg string, components []discordgo.MessageComponent)
+	// replyCoolDown tells the user that posting is cooling down in the way of notice, one of coolDownNotices.
+	// The auto-deleted notice is deleted after life.
+	replyCoolDown(msg, notice string, life time.Duration)
+}
+
+// isNSFWChannel reports whether the channel, or the parent channel of the thread, is age-restricted.
+// DMs are never age-restricted. The channel is looked up in the state first and then by the API.
+func isNSFWChannel(s *discordgo.Session, channelID string) bool {
+	ch, err := s.State.Channel(channelID)
+	if err != nil {
+		if ch, err = s.Channel(channelID); err != nil {
+			log.Println("Failed to get the channel:", err)
+			return false
+		}
+	}
+	if ch.IsThread() {
+		return isNSFWChannel(s, ch.ParentID)
+	}
+	return ch.NSFW
+}
+
+// postableStickers filters out the NSFW stickers unless the channel of h is age-restricted.
+func postableStickers(h handler, ss []*sticker.Sticker) []*sticker.Sticker {
+	if !slices.ContainsFunc(ss, (*sticker.Sticker).NSFW) || h.nsfwChannel() {
+		return ss
+	}
+	var ret []*sticker.Sticker
+	for _, s := range ss {
+		if !s.NSFW() {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+const nsfwRefusalMsg = "This sticker can only be posted in age-restricted channels."
+
+// hiddenNSFWName replaces the names of the NSFW stickers listed outside age-restricted channels.
+const hiddenNSFWName = "(NSFW sticker)"
+
+// shownName returns the name of s, or hiddenNSFWName if s is NSFW and showNSFW is false.
+func shownName(s *sticker.Sticker, showNSFW bool) string {
+	if s.NSFW() && !showNSFW {
+		return hiddenNSFWName
+	}
+	return s.Name()
 }
 
 type messageHandler struct {
@@ -86,6 +391,19 @@ func (h *messageHandler) userInfo() string {
 	return fmt.Sprintf("[User: ID=%s, Name=%s]", u.ID, u.String())
 }
 
+func (h *messageHandler) userID() string    { return h.m.Author.ID }
+func (h *messageHandler) guildID() string   { return h.m.GuildID }
+func (h *messageHandler) channelID() string { return h.m.ChannelID }
+
+func (h *messageHandler) nsfwChannel() bool { return isNSFWChannel(h.s, h.m.ChannelID) }
+
+func (h *messageHandler) memberRoles() []string {
+	if h.m.Member == nil {
+		return nil
+	}
+	return h.m.Member.Roles
+}
+
 // replyPublic sends message back to the channel from where we got the message.
 func (h *messageHandler) replyPublic(msg string) {
 	if _, err := h.s.ChannelMessageSendComplex(h.m.ChannelID, &discordgo.MessageSend{
@@ -129,6 +447,47 @@ func (h *messageHandler) replyPrivate(msg string) {
 	h.replyPublic("Direct message is sent!")
 }
 
+// replyComponents replies publicly since the components in DM would act on the DM channel.
+func (h *messageHandler) replyComponents(msg string, components []discordgo.MessageComponent) {
+	if _, err := h.s.ChannelMessageSendComplex(h.m.ChannelID, &discordgo.MessageSend{
+		Content:    msg,
+		Components: components,
+		Reference: &discordgo.MessageReference{
+			MessageID: h.m.ID,
+			ChannelID: h.m.ChannelID,
+			GuildID:   h.m.GuildID,
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}); err != nil {
+		log.Println("Failed to reply:", err)
+	}
+}
+
+// replyCoolDown replies publicly, and the notice is deleted after life unless notice is "public".
+func (h *messageHandler) replyCoolDown(msg, notice string, life time.Duration) {
+	sent, err := h.s.ChannelMessageSendComplex(h.m.ChannelID, &discordgo.MessageSend{
+		Content: msg,
+		Reference: &discordgo.MessageReference{
+			MessageID: h.m.ID,
+			ChannelID: h.m.ChannelID,
+			GuildID:   h.m.GuildID,
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Println("Failed to reply:", err)
+		return
+	}
+	if notice == "public" {
+		return
+	}
+	time.AfterFunc(life, func() {
+		if err := h.s.ChannelMessageDelete(sent.ChannelID, sent.ID); err != nil {
+			log.Println("Failed to delete the cooling down message:", err)
+		}
+	})
+}
+
 func (h *messageHandler) postSticker(r io.Reader, ext string) error {
 	_, err := h.s.ChannelMessageSendComplex(h.m.ChannelID, &discordgo.MessageSend{
 		Files: []*discordgo.File{{
@@ -152,14 +511,31 @@ type commandHandler struct {
 	replied bool
 }
 
-func (h *commandHandler) userInfo() string {
-	u := h.i.User
-	if u == nil {
-		u = h.i.Member.User
+func (h *commandHandler) user() *discordgo.User {
+	if h.i.User != nil {
+		return h.i.User
 	}
+	return h.i.Member.User
+}
+
+func (h *commandHandler) userInfo() string {
+	u := h.user()
 	return fmt.Sprintf("[User: ID=%s, Name=%s]", u.ID, u.String())
 }
 
+func (h *commandHandler) userID() string    { return h.user().ID }
+func (h *commandHandler) guildID() string   { return h.i.GuildID }
+func (h *commandHandler) channelID() string { return h.i.ChannelID }
+
+func (h *commandHandler) nsfwChannel() bool { return isNSFWChannel(h.s, h.i.ChannelID) }
+
+func (h *commandHandler) memberRoles() []string {
+	if h.i.Member == nil {
+		return nil
+	}
+	return h.i.Member.Roles
+}
+
 func (h *commandHandler) reply(msg string, ephemeral bool, components []discordgo.MessageComponent) {
 	var flags discordgo.MessageFlags
 	if ephemeral {
@@ -192,6 +568,51 @@ func (h *commandHandler) replyPublic(msg string) {
 	h.reply(msg, false, nil)
 }
 
+func (h *commandHandler) replyComponents(msg string, components []discordgo.MessageComponent) {
+	h.reply(msg, true, components)
+}
+
+func (h *commandHandler) replyCoolDown(msg, notice string, life time.Duration) {
+	if notice == "ephemeral" {
+		h.replyPrivate(msg)
+		return
+	}
+
+	if h.i.Type == discordgo.InteractionMessageComponent {
+		// The response of the button is deferred and deleted afterwards, so the notice is sent to the channel.
+		if h.i.Member != nil {
+			msg = h.i.Member.Mention() + " clicked button: " + msg
+		}
+		sent, err := h.s.ChannelMessageSendComplex(h.i.ChannelID, &discordgo.MessageSend{
+			Content:         msg,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			log.Println("Failed to sent cooling down message:", err)
+			h.replyPrivate("Something goes wrong here! Please contact the admin.")
+			return
+		}
+		if notice == "auto-delete" {
+			time.AfterFunc(life, func() {
+				if err := h.s.ChannelMessageDelete(sent.ChannelID, sent.ID); err != nil {
+					log.Println("Failed to delete the cooling down message:", err)
+				}
+			})
+		}
+		return
+	}
+
+	// Every command checks the cooldown before replying, so the notice is always the interaction response.
+	h.replyPublic(msg)
+	if notice == "auto-delete" {
+		time.AfterFunc(life, func() {
+			if err := h.s.InteractionResponseDelete(h.i.Interaction); err != nil {
+				log.Println("Failed to delete the cooling down message:", err)
+			}
+		})
+	}
+}
+
 func (h *commandHandler) postSticker(r io.Reader, ext string) error {
 	files := []*discordgo.File{{
 		Name:        "sticker" + ext,
@@ -269,16 +690,42 @@ func quotedMessagesToTrunks(lines []string) []string {
 	return ret
 }
 
-func handleList(h handler, sm *sticker.Manager, patterns string) {
-	sm.RLock()
-	defer sm.RUnlock()
+// splitCategory extracts the "@<category>" argument from the space separated arguments.
+func splitCategory(arg string) (rest, category string, err error) {
+	var words []string
+	for _, w := range strings.Fields(arg) {
+		if len(w) > 1 && w[0] == '@' {
+			if category != "" {
+				return "", "", errors.New("Only one category can be given.")
+			}
+			category = w[1:]
+			continue
+		}
+		words = append(words, w)
+	}
+	return strings.Join(words, " "), category, nil
+}
 
+// searchStickers returns the stickers matching patterns in category.
+// Empty patterns match all stickers, and empty category means all categories.
+func searchStickers(sm *sticker.Manager, patterns, category string) []*sticker.Sticker {
 	var ss []*sticker.Sticker
-	if patterns == "" {
+	if strings.TrimSpace(patterns) == "" {
 		ss = sm.Stickers()
 	} else {
 		ss = sm.MatchedStickers(buildPatternGroups(patterns))
 	}
+	if category != "" {
+		ss = sm.InCategory(ss, category)
+	}
+	return ss
+}
+
+func handleList(h handler, sm *sticker.Manager, patterns, category string) {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	ss := postableStickers(h, searchStickers(sm, patterns, category))
 
 	if len(ss) == 0 {
 		h.replyPrivate("No matched stickers found!")
@@ -295,11 +742,72 @@ func handleList(h handler, sm *sticker.Manager, patterns string) {
 	}
 }
 
-func handleAdd(h handler, sm *sticker.Manager, name, url string) {
+// handleCategories lists the categories with the number of stickers in them, including the sub-categories.
+func handleCategories(h handler, sm *sticker.Manager) {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	counts := make(map[string]int)
+	for _, s := range sm.Stickers() {
+		c := s.Category()
+		for c != "" {
+			counts[c]++
+			i := strings.LastIndex(c, "/")
+			if i < 0 {
+				break
+			}
+			c = c[:i]
+		}
+	}
+	if len(counts) == 0 {
+		h.replyPrivate("There are no categories.")
+		return
+	}
+
+	categories := make([]string, 0, len(counts))
+	for c := range counts {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+	msgs := make([]string, len(categories))
+	for i, c := range categories {
+		msgs[i] = fmt.Sprintf("@%s (%d)", c, counts[c])
+	}
+	for _, msg := range quotedMessagesToTrunks(msgs) {
+		h.replyPrivate(msg)
+	}
+}
+
+// audited appends the mutation done by the user of h to the audit log.
+// The hash is computed from the file at path if path is not empty.
+func audited(h handler, al *audit.Log, e audit.Entry, path string) {
+	e.ActorID = h.userID()
+	e.GuildID = h.guildID()
+	e.Time = time.Now()
+	if path != "" {
+		hash, err := audit.HashFile(path)
+		if err != nil {
+			log.Println("Failed to hash the sticker:", err)
+		}
+		e.Hash = hash
+	}
+	if err := al.Add(e); err != nil {
+		log.Println("Failed to write the audit log:", err)
+	}
+}
+
+func handleAdd(h handler, sm *sticker.Manager, al *audit.Log, qc *quotaChecker, name, category, url string) {
 	sm.Lock()
 	defer sm.Unlock()
 
-	if err := sm.AddSticker(name, url); err != nil {
+	note, err := qc.check(h, sm, true)
+	if err != nil {
+		h.replyPublic(err.Error())
+		return
+	}
+
+	s, err := sm.AddSticker(name, category, url, h.userID())
+	if err != nil {
 		if err != sticker.UninformableErr {
 			h.replyPublic(err.Error())
 		} else {
@@ -308,15 +816,23 @@ func handleAdd(h handler, sm *sticker.Manager, name, url string) {
 		return
 	}
 
-	log.Printf("%s `add` %q %q", h.userInfo(), name, url)
-	h.replyPublic(fmt.Sprintf("Done. Added sticker: `%s`", name))
+	log.Printf("%s `add` %q %q %q", h.userInfo(), name, category, url)
+	audited(h, al, audit.Entry{Action: audit.ActionAdd, StickerID: s.ID(), NewName: s.Name(), URL: url}, s.Path())
+	h.replyPublic(fmt.Sprintf("Done. Added sticker: `%s`.%s", s.Name(), note))
 }
 
-func handleAddText(h handler, sm *sticker.Manager, name, text string) {
+func handleAddText(h handler, sm *sticker.Manager, al *audit.Log, qc *quotaChecker, name, category, text string) {
 	sm.Lock()
 	defer sm.Unlock()
 
-	if err := sm.AddText(name, text); err != nil {
+	note, err := qc.check(h, sm, true)
+	if err != nil {
+		h.replyPublic(err.Error())
+		return
+	}
+
+	s, err := sm.AddText(name, category, text, h.userID())
+	if err != nil {
 		if err != sticker.UninformableErr {
 			h.replyPublic(err.Error())
 		} else {
@@ -325,15 +841,23 @@ func handleAddText(h handler, sm *sticker.Manager, name, text string) {
 		return
 	}
 
-	log.Printf("%s `add` %q %q", h.userInfo(), name, text)
-	h.replyPublic(fmt.Sprintf("Done. Added text: `%s`", name))
+	log.Printf("%s `add` %q %q %q", h.userInfo(), name, category, text)
+	audited(h, al, audit.Entry{Action: audit.ActionAddText, StickerID: s.ID(), NewName: s.Name()}, s.Path())
+	h.replyPublic(fmt.Sprintf("Done. Added text: `%s`.%s", s.Name(), note))
 }
 
-func handleRename(h handler, sm *sticker.Manager, name, newName string) {
+func handleRename(h handler, sm *sticker.Manager, al *audit.Log, qc *quotaChecker, name, newName, category string) {
 	sm.Lock()
 	defer sm.Unlock()
 
-	if err := sm.RenameSticker(name, newName); err != nil {
+	note, err := qc.check(h, sm, false)
+	if err != nil {
+		h.replyPublic(err.Error())
+		return
+	}
+
+	s, oldName, err := sm.RenameSticker(name, newName, category, h.userID())
+	if err != nil {
 		if err != sticker.UninformableErr {
 			h.replyPublic(err.Error())
 		} else {
@@ -342,85 +866,834 @@ func handleRename(h handler, sm *sticker.Manager, name, newName string) {
 		return
 	}
 
-	log.Printf("%s `rename` %q %q", h.userInfo(), name, newName)
-	h.replyPublic(fmt.Sprintf("Done. Renamed sticker: `%s` -> `%s`", name, newName))
+	log.Printf("%s `rename` %q %q %q", h.userInfo(), name, newName, category)
+	audited(h, al, audit.Entry{Action: audit.ActionRename, StickerID: s.ID(), OldName: oldName, NewName: s.Name()}, s.Path())
+	h.replyPublic(fmt.Sprintf("Done. Renamed sticker: `%s` -> `%s`.%s", oldName, s.Name(), note))
 }
 
-func doPost(h handler, s *sticker.Sticker) {
-	if s.Ext() == ".txt" {
-		text, err := os.ReadFile(s.Path())
-		if err != nil {
-			log.Println("Failed to read the text:", err)
-			h.replyPublic("Something goes wrong here! Please contact the admin.")
+// parseUserMention returns the user ID in a mention like `<@123>`, or the argument itself if it's an ID.
+func parseUserMention(arg string) (string, bool) {
+	arg = strings.TrimSpace(arg)
+	if id, ok := strings.CutPrefix(arg, "<@"); ok {
+		arg = strings.TrimPrefix(strings.TrimSuffix(id, ">"), "!")
+	}
+	if _, err := strconv.ParseUint(arg, 10, 64); err != nil {
+		return "", false
+	}
+	return arg, true
+}
+
+// handleUndo reverts the most recent change made by the user actor.
+func handleUndo(h handler, sm *sticker.Manager, al *audit.Log, actor string, window time.Duration) {
+	sm.Lock()
+	defer sm.Unlock()
+
+	op, err := sm.Undo(actor, window)
+	if err != nil {
+		if err != sticker.UninformableErr {
+			h.replyPublic(err.Error())
 		} else {
-			h.replyPublic(string(text))
+			h.replyPublic("Something goes wrong here! Please contact the admin.")
 		}
 		return
 	}
 
-	r, err := os.Open(s.Path())
+	log.Printf("%s `undo` %s of %s %q %q", h.userInfo(), op.Kind, op.Actor, op.OldName, op.NewName)
+	if op.Kind == sticker.OpRename {
+		path := ""
+		if s := sm.StickerByID(op.StickerID); s != nil {
+			path = s.Path()
+		}
+		audited(h, al, audit.Entry{Action: audit.ActionUndo, StickerID: op.StickerID, OldName: op.NewName, NewName: op.OldName}, path)
+		h.replyPublic(fmt.Sprintf("Done. Renamed sticker back: `%s` -> `%s`", op.NewName, op.OldName))
+	} else {
+		audited(h, al, audit.Entry{Action: audit.ActionUndo, StickerID: op.StickerID, OldName: op.NewName}, "")
+		h.replyPublic(fmt.Sprintf("Done. Removed sticker: `%s`", op.NewName))
+	}
+}
+
+// handleNSFW sets the NSFW flag of the sticker matching pattern.
+func handleNSFW(h handler, sm *sticker.Manager, al *audit.Log, pattern string, nsfw bool) {
+	sm.Lock()
+	defer sm.Unlock()
+
+	stickers, err := matchPostPattern(sm, pattern)
 	if err != nil {
-		log.Println("Failed to open the image:", err)
-		h.replyPublic("Something goes wrong here! Please contact the admin.")
+		h.replyPublic(err.Error())
+		return
+	}
+	if len(stickers) == 0 {
+		h.replyPublic("Cannot find the sticker you're looking for. Find the sticker name with `list` command.")
+		return
+	}
+	if len(stickers) > 1 {
+		matchedStr := sticker.StickerListString(stickers)
+		h.replyPublic("Found more than one stickers! Please provide more specific patterns. Matched: " + matchedStr)
 		return
 	}
-	defer r.Close()
 
-	if err := h.postSticker(r, s.Ext()); err != nil {
-		log.Println("Failed to post sticker:", err)
+	s := stickers[0]
+	if err := sm.SetNSFW(s, nsfw); err != nil {
 		h.replyPublic("Something goes wrong here! Please contact the admin.")
 		return
 	}
+
+	log.Printf("%s `nsfw` %q %t", h.userInfo(), s.Name(), nsfw)
+	if nsfw {
+		audited(h, al, audit.Entry{Action: audit.ActionNSFWOn, StickerID: s.ID(), NewName: s.Name()}, "")
+		h.replyPublic(fmt.Sprintf("Done. Sticker `%s` can only be posted in age-restricted channels now.", s.Name()))
+	} else {
+		audited(h, al, audit.Entry{Action: audit.ActionNSFWOff, StickerID: s.ID(), NewName: s.Name()}, "")
+		h.replyPublic(fmt.Sprintf("Done. Sticker `%s` can be posted anywhere now.", s.Name()))
+	}
+}
+
+// formatBytes formats n in a human readable unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
 }
 
-func handleRandom(h handler, sm *sticker.Manager, patterns string) {
+const usageLargestCount = 5
+
+// handleUsage shows the disk usage of the library.
+func handleUsage(h handler, sm *sticker.Manager) {
 	sm.RLock()
 	defer sm.RUnlock()
 
-	stickers := sm.MatchedStickers(buildPatternGroups(patterns))
+	u := sm.DiskUsage(usageLargestCount)
 
-	if len(stickers) == 0 {
-		h.replyPublic("Cannot find any matched sticker. Find the sticker names with `list` command.")
-		return
+	var counts []string
+	for _, ext := range []string{"png", "gif", "jpeg", "webp", "txt"} {
+		counts = append(counts, fmt.Sprintf("%s: %d", ext, u.Counts[ext]))
+		delete(u.Counts, ext)
+	}
+	var others []string
+	for ext := range u.Counts {
+		others = append(others, ext)
+	}
+	sort.Strings(others)
+	for _, ext := range others {
+		counts = append(counts, fmt.Sprintf("%s: %d", ext, u.Counts[ext]))
 	}
 
-	doPost(h, stickers[rand.Intn(len(stickers))])
+	msgs := []string{
+		fmt.Sprintf("Stickers: %d (%s)", len(sm.Stickers()), strings.Join(counts, ", ")),
+		fmt.Sprintf("Total size: %s, including %s waiting for approval", formatBytes(u.Bytes), formatBytes(u.PendingBytes)),
+	}
+	if u.Quota > 0 {
+		msgs = append(msgs, fmt.Sprintf("Quota: %s, %s left", formatBytes(u.Quota), formatBytes(max(u.Quota-u.Bytes, 0))))
+	} else {
+		msgs = append(msgs, "Quota: unlimited")
+	}
+	if len(u.Largest) != 0 {
+		showNSFW := h.nsfwChannel()
+		msgs = append(msgs, "Largest stickers:")
+		for i, ss := range u.Largest {
+			msgs = append(msgs, fmt.Sprintf("%d. %s (%s)", i+1, shownName(ss.Sticker, showNSFW), formatBytes(ss.Size)))
+		}
+	}
+	for _, msg := range quotedMessagesToTrunks(msgs) {
+		h.replyPrivate(msg)
+	}
 }
 
-func handlePost(h handler, sm *sticker.Manager, pattern string, handleMulti func([]*sticker.Sticker)) {
+const defaultHistoryCount = 20
+
+// handleHistory shows the audit log of the stickers matching patterns, the most recent first.
+// The entries are matched by the sticker IDs of the current stickers, so the history follows renames,
+// and by the recorded names, so that the stickers no longer in the library can be found too.
+func handleHistory(h handler, sm *sticker.Manager, al *audit.Log, patterns string) {
 	sm.RLock()
 	defer sm.RUnlock()
 
-	pg := buildPatternGroups(pattern)
-	if len(pg) > 1 {
-		h.replyPublic("Post command should not contain slash (`/`).")
+	var match func(*audit.Entry) bool
+	if strings.TrimSpace(patterns) == "" {
+		match = func(*audit.Entry) bool { return true }
+	} else {
+		pgs := buildPatternGroups(strings.ToLower(patterns))
+		ids := make(map[string]bool)
+		for _, s := range sm.MatchedStickers(buildPatternGroups(patterns)) {
+			ids[s.ID()] = true
+		}
+		nameMatches := func(name string) bool {
+			name = strings.ToLower(name)
+			for _, pg := range pgs {
+				if len(pg) != 0 && !slices.ContainsFunc(pg, func(p string) bool { return !strings.Contains(name, p) }) {
+					return true
+				}
+			}
+			return false
+		}
+		match = func(e *audit.Entry) bool {
+			return ids[e.StickerID] || nameMatches(e.OldName) || nameMatches(e.NewName)
+		}
+	}
+
+	es := al.Entries(match)
+	if len(es) == 0 {
+		h.replyPrivate("No history found!")
+		return
+	}
+	if len(es) > defaultHistoryCount {
+		es = es[:defaultHistoryCount]
+	}
+
+	showNSFW := h.nsfwChannel()
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%s %s by %s: ", e.Time.Format(time.DateTime), e.Action, e.ActorID)
+		s := sm.StickerByID(e.StickerID)
+		hidden := s != nil && s.NSFW() && !showNSFW
+		switch {
+		case hidden:
+			sb.WriteString(hiddenNSFWName)
+		case e.OldName != "" && e.NewName != "":
+			fmt.Fprintf(&sb, "%s -> %s", e.OldName, e.NewName)
+		case e.NewName != "":
+			sb.WriteString(e.NewName)
+		default:
+			sb.WriteString(e.OldName)
+		}
+		if e.URL != "" && !hidden {
+			fmt.Fprintf(&sb, " from %s", e.URL)
+		}
+		if e.Hash != "" {
+			fmt.Fprintf(&sb, " sha256:%.12s", e.Hash)
+		}
+		msgs[i] = sb.String()
+	}
+	for _, msg := range quotedMessagesToTrunks(msgs) {
+		h.replyPrivate(msg)
+	}
+}
+
+// usageTracker is notified of every successful post.
+type usageTracker struct {
+	stats  *stats.Recorder
+	recent *userdata.Recent
+}
+
+func (ut *usageTracker) posted(h handler, s *sticker.Sticker) {
+	if err := ut.stats.Add(stats.Record{
+		StickerID: s.ID(),
+		Sticker:   s.Name(),
+		GuildID:   h.guildID(),
+		ChannelID: h.channelID(),
+		UserID:    h.userID(),
+		Time:      time.Now(),
+	}); err != nil {
+		log.Println("Failed to record the usage:", err)
+	}
+	ut.recent.Push(h.userID(), s.ID())
+}
+
+// copySticker returns a copy of s, which can be used after releasing the lock of the manager
+// since renames change s in place.
+func copySticker(s *sticker.Sticker) *sticker.Sticker {
+	c := *s
+	return &c
+}
+
+func doPost(h handler, ut *usageTracker, s *sticker.Sticker, opts postOptions) {
+	if s.NSFW() && !h.nsfwChannel() {
+		h.replyPublic(nsfwRefusalMsg)
+		return
+	}
+	if s.Ext() == ".txt" {
+		if !opts.empty() {
+			h.replyPublic("Captions and other options are only supported by image stickers.")
+			return
+		}
+		text, err := os.ReadFile(s.Path())
+		if err != nil {
+			log.Println("Failed to read the text:", err)
+			h.replyPublic("Something goes wrong here! Please contact the admin.")
+		} else {
+			h.replyPublic(string(text))
+			ut.posted(h, s)
+		}
+		return
+	}
+
+	r, ext, err := openSticker(s.Path(), opts)
+	if err != nil {
+		if err != sticker.UninformableErr {
+			h.replyPublic(err.Error())
+		} else {
+			h.replyPublic("Something goes wrong here! Please contact the admin.")
+		}
+		return
+	}
+	defer r.Close()
+
+	if err := h.postSticker(r, ext); err != nil {
+		log.Println("Failed to post sticker:", err)
+		h.replyPublic("Something goes wrong here! Please contact the admin.")
+		return
+	}
+	ut.posted(h, s)
+}
+
+func handleRandom(h handler, sm *sticker.Manager, ut *usageTracker, patterns, category string) {
+	s := func() *sticker.Sticker {
+		sm.RLock()
+		defer sm.RUnlock()
+
+		stickers := postableStickers(h, searchStickers(sm, patterns, category))
+		if len(stickers) == 0 {
+			h.replyPublic("Cannot find any matched sticker. Find the sticker names with `list` command.")
+			return nil
+		}
+		return copySticker(stickers[rand.Intn(len(stickers))])
+	}()
+	if s == nil {
+		return
+	}
+
+	doPost(h, ut, s, postOptions{})
+}
+
+// matchPostPattern returns the stickers matching the pattern of a post command.
+// The pattern must not contain slashes since it's supposed to select a single sticker.
+func matchPostPattern(sm *sticker.Manager, pattern string) ([]*sticker.Sticker, error) {
+	pg := buildPatternGroups(pattern)
+	if len(pg) > 1 {
+		return nil, errors.New("Post command should not contain slash (`/`).")
+	}
+	return sm.MatchedStickers(pg), nil
+}
+
+func handlePost(h handler, sm *sticker.Manager, ut *usageTracker, pattern string, opts postOptions, handleMulti func([]*sticker.Sticker)) {
+	// Only the matching holds the lock, so that a slow upload doesn't block the changes to the library.
+	s := func() *sticker.Sticker {
+		sm.RLock()
+		defer sm.RUnlock()
+
+		stickers, err := matchPostPattern(sm, pattern)
+		if err != nil {
+			h.replyPublic(err.Error())
+			return nil
+		}
+		if len(stickers) == 0 {
+			h.replyPublic("Cannot find the sticker you're looking for. Find the sticker name with `list` command.")
+			return nil
+		}
+		// The NSFW stickers are hidden outside the age-restricted channels like `list` does.
+		if stickers = postableStickers(h, stickers); len(stickers) == 0 {
+			h.replyPublic(nsfwRefusalMsg)
+			return nil
+		}
+		if len(stickers) > 1 {
+			if handleMulti != nil {
+				handleMulti(stickers)
+			} else {
+				matchedStr := sticker.StickerListString(stickers)
+				h.replyPublic("Found more than one stickers! Please provide more specific patterns. Matched: " + matchedStr)
+			}
+			return nil
+		}
+		return copySticker(stickers[0])
+	}()
+	if s == nil {
+		return
+	}
+
+	doPost(h, ut, s, opts)
+}
+
+const maxComboParts = 10
+
+// handleCombo posts the stickers matching parts as one image.
+// Every part must match exactly one sticker like the post command.
+// The result is a still image; Only the first frames of the animated stickers are used.
+// Every sticker in the combo is recorded as posted in the stats and the recent history.
+func handleCombo(h handler, sm *sticker.Manager, ut *usageTracker, parts []string, grid bool) {
+	if len(parts) < 2 || len(parts) > maxComboParts {
+		h.replyPublic(fmt.Sprintf("Please combine 2 to %d stickers, e.g. `miko + fubuki`.", maxComboParts))
+		return
+	}
+
+	// Only the matching holds the lock, so that a slow rendering doesn't block the changes to the library.
+	stickers := func() []*sticker.Sticker {
+		sm.RLock()
+		defer sm.RUnlock()
+
+		var ret []*sticker.Sticker
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				h.replyPublic(fmt.Sprintf("Part %d is empty.", i+1))
+				return nil
+			}
+			stickers, err := matchPostPattern(sm, part)
+			if err != nil {
+				h.replyPublic(err.Error())
+				return nil
+			}
+			if len(stickers) == 0 {
+				h.replyPublic(fmt.Sprintf("Cannot find the sticker for part %d `%s`. Find the sticker name with `list` command.", i+1, part))
+				return nil
+			}
+			if len(stickers) > 1 {
+				matchedStr := sticker.StickerListString(stickers)
+				h.replyPublic(fmt.Sprintf("Found more than one stickers for part %d `%s`! Please provide more specific patterns. Matched: %s", i+1, part, matchedStr))
+				return nil
+			}
+			s := stickers[0]
+			if s.Ext() == ".txt" {
+				h.replyPublic(fmt.Sprintf("Part %d `%s` is a text sticker and cannot be combined.", i+1, s.Name()))
+				return nil
+			}
+			if s.NSFW() && !h.nsfwChannel() {
+				h.replyPublic(fmt.Sprintf("Part %d: %s", i+1, nsfwRefusalMsg))
+				return nil
+			}
+			ret = append(ret, copySticker(s))
+		}
+		return ret
+	}()
+	if stickers == nil {
+		return
+	}
+
+	var imgs []*imaging.Image
+	for i, s := range stickers {
+		f, err := os.Open(s.Path())
+		if err != nil {
+			log.Println("Failed to open the image:", err)
+			h.replyPublic("Something goes wrong here! Please contact the admin.")
+			return
+		}
+		img, err := decodeSticker(f, s.Ext())
+		f.Close()
+		if err != nil {
+			if err != sticker.UninformableErr {
+				h.replyPublic(fmt.Sprintf("Part %d `%s`: %s", i+1, s.Name(), err))
+			} else {
+				h.replyPublic("Something goes wrong here! Please contact the admin.")
+			}
+			return
+		}
+		imgs = append(imgs, img)
+	}
+
+	columns := len(imgs)
+	if grid {
+		columns = int(math.Ceil(math.Sqrt(float64(len(imgs)))))
+	}
+	img, err := imaging.Collage(imgs, columns)
+	if err != nil {
+		h.replyPublic(err.Error())
+		return
+	}
+	data, ext, err := encodeSticker(img)
+	if err != nil {
+		if err != sticker.UninformableErr {
+			h.replyPublic(err.Error())
+		} else {
+			h.replyPublic("Something goes wrong here! Please contact the admin.")
+		}
+		return
+	}
+	if err := h.postSticker(bytes.NewReader(data), ext); err != nil {
+		log.Println("Failed to post sticker:", err)
+		h.replyPublic("Something goes wrong here! Please contact the admin.")
+		return
+	}
+	for _, s := range stickers {
+		ut.posted(h, s)
+	}
+}
+
+// usageIndex looks up the usages of the stickers.
+// The records written before the sticker IDs were introduced are looked up by name.
+type usageIndex struct {
+	byID   map[string]stats.Usage
+	byName map[string]stats.Usage
+}
+
+func newUsageIndex(us []stats.Usage) *usageIndex {
+	ui := &usageIndex{byID: make(map[string]stats.Usage), byName: make(map[string]stats.Usage)}
+	for _, u := range us {
+		if u.StickerID != "" {
+			ui.byID[u.StickerID] = u
+		} else {
+			ui.byName[u.Sticker] = u
+		}
+	}
+	return ui
+}
+
+func (ui *usageIndex) get(s *sticker.Sticker) stats.Usage {
+	u := ui.byID[s.ID()]
+	legacy := ui.byName[s.Name()]
+	u.Count += legacy.Count
+	if legacy.LastUsed.After(u.LastUsed) {
+		u.LastUsed = legacy.LastUsed
+	}
+	return u
+}
+
+func handleStats(h handler, sm *sticker.Manager, ut *usageTracker, patterns string) {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	var ss []*sticker.Sticker
+	if patterns == "" {
+		ss = sm.Stickers()
+	} else {
+		ss = sm.MatchedStickers(buildPatternGroups(patterns))
+	}
+	ss = postableStickers(h, ss)
+
+	if len(ss) == 0 {
+		h.replyPrivate("No matched stickers found!")
+		return
+	}
+
+	us, err := ut.stats.Usages(stats.Filter{})
+	if err != nil {
+		log.Println("Failed to read the usage statistics:", err)
+		h.replyPrivate("Something goes wrong here! Please contact the admin.")
+		return
+	}
+	global := newUsageIndex(us)
+	var guild *usageIndex
+	if h.guildID() != "" {
+		us, err := ut.stats.Usages(stats.Filter{GuildID: h.guildID()})
+		if err != nil {
+			log.Println("Failed to read the usage statistics:", err)
+			h.replyPrivate("Something goes wrong here! Please contact the admin.")
+			return
+		}
+		guild = newUsageIndex(us)
+	}
+
+	ss = slices.Clone(ss)
+	sort.SliceStable(ss, func(i, j int) bool { return global.get(ss[i]).Count > global.get(ss[j]).Count })
+
+	msgs := make([]string, len(ss))
+	for i, s := range ss {
+		u := global.get(s)
+		msg := fmt.Sprintf("%s: %d posts", s.Name(), u.Count)
+		if guild != nil {
+			msg += fmt.Sprintf(", %d in this guild", guild.get(s).Count)
+		}
+		if !u.LastUsed.IsZero() {
+			msg += ", last posted at " + u.LastUsed.Format(time.DateOnly)
+		}
+		msgs[i] = msg
+	}
+
+	for _, msg := range quotedMessagesToTrunks(msgs) {
+		h.replyPrivate(msg)
+	}
+}
+
+// parseSince parses durations like "7d", "2w" or anything accepted by time.ParseDuration.
+func parseSince(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	var d time.Duration
+	if unit != 0 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil {
+			return 0, fmt.Errorf("Invalid duration `%s`. Expect something like `7d`, `2w` or `12h`.", s)
+		}
+		d = time.Duration(n) * unit
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("Invalid duration `%s`. Expect something like `7d`, `2w` or `12h`.", s)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("Invalid duration `%s`. Expect a positive duration.", s)
+	}
+	return d, nil
+}
+
+const defaultTopCount = 10
+
+// handleTop shows the most posted stickers.
+// The ranking is scoped to the current guild unless global is set or the command is sent from DM.
+// A zero since includes all records.
+func handleTop(h handler, sm *sticker.Manager, ut *usageTracker, n int, global bool, since time.Duration) {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	filter := stats.Filter{}
+	scope := "all guilds"
+	if !global && h.guildID() != "" {
+		filter.GuildID = h.guildID()
+		scope = "this guild"
+	}
+	if since != 0 {
+		filter.Since = time.Now().Add(-since)
+	}
+
+	us, err := ut.stats.Usages(filter)
+	if err != nil {
+		log.Println("Failed to read the usage statistics:", err)
+		h.replyPrivate("Something goes wrong here! Please contact the admin.")
+		return
+	}
+	if len(us) == 0 {
+		h.replyPrivate("No stickers have been posted yet!")
 		return
 	}
+	if len(us) > n {
+		us = us[:n]
+	}
+
+	header := fmt.Sprintf("Top %d stickers in %s", len(us), scope)
+	if since != 0 {
+		header += " since " + filter.Since.Format(time.DateTime)
+	}
+	showNSFW := h.nsfwChannel()
+	msgs := []string{header + ":"}
+	for i, u := range us {
+		name := u.Sticker
+		if s := sm.StickerByID(u.StickerID); s != nil {
+			// Show the current name in case the sticker has been renamed.
+			name = shownName(s, showNSFW)
+		}
+		msgs = append(msgs, fmt.Sprintf("%d. %s (%d)", i+1, name, u.Count))
+	}
+	for _, msg := range quotedMessagesToTrunks(msgs) {
+		h.replyPrivate(msg)
+	}
+}
+
+func handleFavAdd(h handler, sm *sticker.Manager, favs *userdata.Favorites, pattern string) {
+	sm.RLock()
+	defer sm.RUnlock()
 
-	stickers := sm.MatchedStickers(pg)
+	stickers, err := matchPostPattern(sm, pattern)
+	if err != nil {
+		h.replyPublic(err.Error())
+		return
+	}
 	if len(stickers) == 0 {
 		h.replyPublic("Cannot find the sticker you're looking for. Find the sticker name with `list` command.")
 		return
 	}
 	if len(stickers) > 1 {
-		if handleMulti != nil {
-			handleMulti(stickers)
+		matchedStr := sticker.StickerListString(stickers)
+		h.replyPublic("Found more than one stickers! Please provide more specific patterns. Matched: " + matchedStr)
+		return
+	}
+
+	if err := favs.Add(h.userID(), stickers[0].ID()); err != nil {
+		if err != userdata.UninformableErr {
+			h.replyPublic(err.Error())
 		} else {
-			matchedStr := sticker.StickerListString(stickers)
-			h.replyPublic("Found more than one stickers! Please provide more specific patterns. Matched: " + matchedStr)
+			h.replyPublic("Something goes wrong here! Please contact the admin.")
+		}
+		return
+	}
+	h.replyPublic(fmt.Sprintf("Done. Added `%s` to your favorites.", stickers[0].Name()))
+}
+
+// favoriteStickers resolves the favorites of the user.
+// The stickers that no longer exist are nil.
+// The caller should hold the read lock of sm.
+func favoriteStickers(sm *sticker.Manager, favs *userdata.Favorites, userID string) ([]string, []*sticker.Sticker) {
+	ids := favs.List(userID)
+	ss := make([]*sticker.Sticker, len(ids))
+	for i, id := range ids {
+		ss[i] = sm.StickerByID(id)
+	}
+	return ids, ss
+}
+
+// parseFavIndex parses the 1-based index of a favorite.
+func parseFavIndex(arg string, n int) (int, bool) {
+	i, err := strconv.Atoi(arg)
+	if err != nil || i < 1 || i > n {
+		return 0, false
+	}
+	return i - 1, true
+}
+
+// handleFavRemove removes a favorite, which is specified by either its index or patterns.
+func handleFavRemove(h handler, sm *sticker.Manager, favs *userdata.Favorites, arg string) {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	ids, ss := favoriteStickers(sm, favs, h.userID())
+	target := ""
+	if i, ok := parseFavIndex(arg, len(ids)); ok {
+		target = ids[i]
+	} else {
+		var matched []*sticker.Sticker
+		for _, s := range sm.MatchedStickers([][]string{strings.Fields(arg)}) {
+			if slices.Contains(ss, s) {
+				matched = append(matched, s)
+			}
+		}
+		if len(matched) == 0 {
+			h.replyPublic("Cannot find the sticker in your favorites. Show your favorites with `fav list` command.")
+			return
+		}
+		if len(matched) > 1 {
+			h.replyPublic("Found more than one stickers in your favorites! Please provide more specific patterns. Matched: " + sticker.StickerListString(matched))
+			return
+		}
+		target = matched[0].ID()
+	}
+
+	if err := favs.Remove(h.userID(), target); err != nil {
+		if err != userdata.UninformableErr {
+			h.replyPublic(err.Error())
+		} else {
+			h.replyPublic("Something goes wrong here! Please contact the admin.")
+		}
+		return
+	}
+	h.replyPublic("Done. Removed the sticker from your favorites.")
+}
+
+func handleFavList(h handler, sm *sticker.Manager, favs *userdata.Favorites) {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	_, ss := favoriteStickers(sm, favs, h.userID())
+	if len(ss) == 0 {
+		h.replyPrivate("You don't have any favorites yet! Add one with `fav add` command.")
+		return
+	}
+
+	showNSFW := h.nsfwChannel()
+	msgs := make([]string, len(ss))
+	for i, s := range ss {
+		name := "(deleted sticker)"
+		if s != nil {
+			name = shownName(s, showNSFW)
+		}
+		msgs[i] = fmt.Sprintf("%d. %s", i+1, name)
+	}
+	for _, msg := range quotedMessagesToTrunks(msgs) {
+		h.replyPrivate(msg)
+	}
+}
+
+// handleFavPost posts a favorite of the user. arg is either an index or "random".
+func handleFavPost(h handler, sm *sticker.Manager, ut *usageTracker, favs *userdata.Favorites, arg string) {
+	s := func() *sticker.Sticker {
+		sm.RLock()
+		defer sm.RUnlock()
+
+		_, ss := favoriteStickers(sm, favs, h.userID())
+		if arg == "random" {
+			var existing []*sticker.Sticker
+			for _, s := range ss {
+				if s != nil {
+					existing = append(existing, s)
+				}
+			}
+			if len(existing) == 0 {
+				h.replyPublic("You don't have any favorites yet! Add one with `fav add` command.")
+				return nil
+			}
+			if existing = postableStickers(h, existing); len(existing) == 0 {
+				h.replyPublic("All your favorites can only be posted in age-restricted channels.")
+				return nil
+			}
+			return copySticker(existing[rand.Intn(len(existing))])
+		}
+
+		i, ok := parseFavIndex(arg, len(ss))
+		if !ok {
+			h.replyPublic(fmt.Sprintf("Invalid favorite number `%s`. Show your favorites with `fav list` command.", arg))
+			return nil
+		}
+		if ss[i] == nil {
+			h.replyPublic("The sticker has been deleted.")
+			return nil
 		}
+		return copySticker(ss[i])
+	}()
+	if s == nil {
 		return
 	}
 
-	doPost(h, stickers[0])
+	doPost(h, ut, s, postOptions{})
 }
 
-func handleHelp(h handler, appCommand bool) {
+// recentStickers resolves the stickers recently posted by the user, skipping the deleted ones.
+// The caller should hold the read lock of sm.
+func recentStickers(sm *sticker.Manager, ut *usageTracker, userID string) []*sticker.Sticker {
+	var ss []*sticker.Sticker
+	for _, id := range ut.recent.List(userID) {
+		if s := sm.StickerByID(id); s != nil {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
+
+func handleRecent(h handler, sm *sticker.Manager, ut *usageTracker) {
+	sm.RLock()
+	defer sm.RUnlock()
+
+	ss := postableStickers(h, recentStickers(sm, ut, h.userID()))
+	if len(ss) == 0 {
+		h.replyPrivate("You haven't posted any stickers recently!")
+		return
+	}
+	h.replyComponents("Your recently posted stickers:", postButtons(ss, postOptions{}))
+}
+
+// handleRepost posts the sticker most recently posted by the user again.
+func handleRepost(h handler, sm *sticker.Manager, ut *usageTracker) {
+	s := func() *sticker.Sticker {
+		sm.RLock()
+		defer sm.RUnlock()
+
+		ss := recentStickers(sm, ut, h.userID())
+		if len(ss) == 0 {
+			h.replyPublic("You haven't posted any stickers recently!")
+			return nil
+		}
+		return copySticker(ss[0])
+	}()
+	if s == nil {
+		return
+	}
+
+	doPost(h, ut, s, postOptions{})
+}
+
+// handleHelp shows the usage of the commands. The text commands are shown with the first prefix in prefixes.
+func handleHelp(h handler, prefixes []string, appCommand bool) {
+	prefix := prefixes[0]
 	sb := strings.Builder{}
 	if !appCommand {
-		sb.WriteString("Please send commands with the prefix `")
-		sb.WriteString(commandPrefix)
-		sb.WriteString("`.\n")
+		if len(prefixes) == 1 {
+			sb.WriteString("Please send commands with the prefix `")
+			sb.WriteString(prefix)
+			sb.WriteString("`.\n")
+		} else {
+			sb.WriteString("Please send commands with one of the prefixes `")
+			sb.WriteString(strings.Join(prefixes, "`, `"))
+			sb.WriteString("`.\n")
+		}
 	}
 	sb.WriteString("Available commands:\n\n")
 	for _, t := range []struct {
@@ -431,23 +1704,56 @@ func handleHelp(h handler, appCommand bool) {
 		"help", "",
 		"Show this message.",
 	}, {
-		"list", "[<pattern>...[ / <pattern>...]...]",
-		"If no pattern is given, list all stickers; Otherwise, list all stickers matching any group of patterns. Groups are separated with slashes.",
+		"list", "[<pattern>...[ / <pattern>...]...] [@<category>]",
+		"If no pattern is given, list all stickers; Otherwise, list all stickers matching any group of patterns. Groups are separated with slashes. With `@<category>`, only the stickers in the category are listed.",
+	}, {
+		"categories", "",
+		"List the categories and the number of stickers in them.",
 	}, {
-		"add", "<sticker_name> <URL>",
-		"Download and save the image at `<URL>` as a new sticker.",
+		"add", "<sticker_name> <URL> [@<category>]",
+		"Download and save the image at `<URL>` as a new sticker, optionally in `<category>`. Sub-categories are separated by slashes, e.g. `@hololive/jp`.",
 	}, {
-		"txt-add", "<sticker_name> <text>",
+		"txt-add", "<sticker_name> [@<category>] <text>",
 		"Add a new plain-text sticker. Can be used for bypassing the image size limit by simply posting an URL.",
 	}, {
-		"rename", "<sticker_name> <new_sticker_name>",
-		"Move the sticker on `<sticker_name>` to `<new_sticker_name>`.",
+		"rename", "<sticker_name> <new_sticker_name> [@<category>]",
+		"Move the sticker on `<sticker_name>` to `<new_sticker_name>`, in `<category>` if given or in its current category otherwise. A bare `@` moves it directly under the root.",
+	}, {
+		"random", "[<pattern>...[ / <pattern>...]...] [@<category>]",
+		"All stickers that match any group of patterns and are in the category will be collected, and a random one will be post. Groups are separated with slashes. Without patterns and category, all stickers are collected.",
+	}, {
+		"stats", "[<pattern>...[ / <pattern>...]...]",
+		"Show how many times the matched stickers have been posted.",
+	}, {
+		"top", "[<n>] [--guild|--global] [--since <duration>]",
+		"Show the `<n>` most posted stickers in this guild or in all guilds, optionally only counting the posts in the last `<duration>`, e.g. `7d`.",
+	}, {
+		"nsfw", "<pattern>... [--off]",
+		"Mark the sticker as NSFW, or unmark it with `--off`. NSFW stickers can only be posted in age-restricted channels, and are hidden elsewhere. Only for the admins.",
+	}, {
+		"usage", "",
+		"Show the number of stickers by type, the disk space they take, the largest ones and the remaining quota.",
+	}, {
+		"undo", "[<user>]",
+		"Revert your most recent `add`, `txt-add` or `rename` if nothing else has changed the sticker since. Admins can revert the change of another user.",
+	}, {
+		"config", "[get | set <key> <value> | reset <key>]",
+		"Show or change the settings of this guild: `" + strings.Join(guildSettingKeys, "`, `") + "`. `reset` restores the value in the config file. Only for the admins.",
+	}, {
+		"history", "[<pattern>...[ / <pattern>...]...]",
+		"Show who added, renamed or reviewed the matched stickers, the most recent first.",
+	}, {
+		"recent", "",
+		"Show the stickers you posted recently with buttons to post them again. `" + prefix + "!` posts the last one again.",
 	}, {
-		"random", "[<pattern>...[ / <pattern>...]...]",
-		"All stickers that match any group of patterns will be collected, and a random one will be post. Groups are separated with slashes.",
+		"fav", "add <pattern>... | remove <pattern>...|<n> | list | <n> | random",
+		"Manage your favorite stickers, or post the `<n>`-th or a random one of them. Favorites follow the stickers when they are renamed.",
 	}, {
-		"post", "<pattern>...",
-		"A command that does not start with slash is considered as patterns. A sticker is posted if it's the only one that matches the patterns. Use `list` command to view the available stickers.",
+		"combo", "<pattern>... + <pattern>...[ + <pattern>...]... [--grid]",
+		"Combine several stickers into one image. Each part separated by `+` must match exactly one sticker like `post`. The images are put in a row, or in a grid with `--grid`. Animated stickers are combined as still images of their first frames.",
+	}, {
+		"post", "<pattern>... [\"<caption>\"] [--top] [--mirror] [--flip] [--rotate <90|180|270>] [--gray] [--x<scale>] [--reverse] [--speed <factor>] [--loop <times>] [-- <pattern>...]",
+		"A command that does not start with slash is considered as patterns. A sticker is posted if it's the only one that matches the patterns. Use `list` command to view the available stickers. The quoted caption is drawn at the bottom of the image, or at the top with `--top`. The other options transform the image before it's posted, e.g. `--x2` doubles the size. `--reverse`, `--speed` and `--loop` only work on GIFs. The words after `--` are always patterns, e.g. `-- --weird-name`.",
 	}} {
 		sb.WriteString("`")
 		if appCommand {
@@ -456,7 +1762,7 @@ func handleHelp(h handler, appCommand bool) {
 			sb.WriteString(" ")
 			sb.WriteString(t.args)
 		} else {
-			sb.WriteString(commandPrefix)
+			sb.WriteString(prefix)
 			if t.command != "post" {
 				sb.WriteString("/")
 				sb.WriteString(t.command)
@@ -475,6 +1781,8 @@ func main() {
 	var (
 		resourcePathPtr   = flag.String("resource-path", "resources", "The root directory of the resources. Each directory in it will become the group name.")
 		configFilePathPtr = flag.String("config-file", "config.json", "The JSON format configuration file. See config.json.example for the supported configs.")
+		dataPathPtr       = flag.String("data-path", "data", "The directory to keep the states of the bot, e.g. the usage statistics.")
+		checkConfigPtr    = flag.Bool("check-config", false, "Validate the config file and the resource directory, and exit without connecting to Discord.")
 	)
 
 	flag.Parse()
@@ -482,62 +1790,116 @@ func main() {
 		flag.PrintDefaults()
 	}
 
-	config := struct {
-		Token           string
-		AppID           string
-		CommandPrefix   string
-		CoolDown        int
-		CoolDownMessage string
-		CaseSensitive   bool
-		PerGuildConfig  []struct {
-			GuildID         string
-			CoolDown        int
-			CoolDownMessage string
-		}
-	}{
-		CommandPrefix:   "!!",
-		CoolDown:        5,
-		CoolDownMessage: "Cooling down...",
-	}
-	configBtyes, err := ioutil.ReadFile(*configFilePathPtr)
+	config, err := readConfig(*configFilePathPtr)
 	if err != nil {
-		log.Fatalln("Failed to read the config file:", err)
+		log.Fatalln("Failed to load the config:", err)
+	}
+	if err := config.validate(); err != nil {
+		log.Fatalf("Invalid config:\n%v", err)
+	}
+	if *checkConfigPtr {
+		log.Println("Config sources:", config.sources)
+		n, err := checkResources(*resourcePathPtr, config.CaseSensitive)
+		if err != nil {
+			log.Fatalf("Invalid resources:\n%v", err)
+		}
+		log.Printf("The config and the %d stickers are fine.", n)
+		return
 	}
-	if err := json.Unmarshal(configBtyes, &config); err != nil {
-		log.Fatalln("Failed to unmarshal the config file:", err)
+	defaultConfig, perGuildConfig := config.guildConfigs()
+	overrides, err := openGuildOverrides(filepath.Join(*dataPathPtr, "guild_config.json"))
+	if err != nil {
+		log.Fatalln("Failed to load the guild overrides:", err)
 	}
+	// gcPtr is swapped on reloading the config. The handlers load it once and use the same manager throughout.
+	// The counter is closed after the session, which is deferred later, so that no handler is using it.
+	cdCounter := utils.NewCoolDownCounter()
+	defer cdCounter.Close()
+	var gcPtr atomic.Pointer[guildConfigManager]
+	gcPtr.Store(newGuildConfigManager(defaultConfig, perGuildConfig, overrides, config.Owners, cdCounter, utils.NewRateLimiter(utils.RealClock{})))
 
-	commandPrefix = config.CommandPrefix
+	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile | log.Lmsgprefix)
 
-	perGuildConfig := make(map[string]guildConfig)
-	for _, conf := range config.PerGuildConfig {
-		perGuildConfig[conf.GuildID] = guildConfig{
-			coolDown:        time.Duration(conf.CoolDown) * time.Second,
-			coolDownMessage: conf.CoolDownMessage,
+	log.Println("Starting...")
+	log.Println("\tresource directory =", *resourcePathPtr)
+	log.Println("\tconfig file        =", *configFilePathPtr)
+	log.Println("\tdata directory     =", *dataPathPtr)
+	// Only the sources are logged; The token itself must never be.
+	log.Println("\t\tconfig sources     =", config.sources)
+	log.Println("\t\tcommand prefixes   =", defaultConfig.prefixes)
+	log.Println("\t\tcase sensitive     =", config.CaseSensitive)
+	log.Println("\t\towners             =", config.Owners)
+	log.Println("\t\tpermissions        =", config.Permissions)
+	log.Println("\t\trecent history     =", config.RecentHistorySize, "persisted:", config.PersistRecentHistory)
+	log.Println("\t\tundo window        =", config.UndoWindow)
+	log.Println("\t\tdaily quotas       =", config.DailyQuotaPerUser, "per user,", config.DailyQuotaPerGuild, "per guild")
+	log.Println("\t\tmax owned stickers =", config.MaxOwnedStickers)
+	log.Println("\t\tdisk quota (MiB)   =", config.DiskQuotaMB)
+	log.Println("\t\tper guild config   =", perGuildConfig)
+	log.Println("\t\tguild overrides    =", overrides.overrides)
+
+	rand.Seed(time.Now().UnixNano())
+
+	if err := os.MkdirAll(*dataPathPtr, 0755); err != nil {
+		log.Fatalln("Failed to create the data directory:", err)
+	}
+
+	sm, err := sticker.NewManager(
+		*resourcePathPtr,
+		sticker.CaseSensitive(config.CaseSensitive),
+		sticker.MetadataPath(filepath.Join(*dataPathPtr, "stickers.json")),
+		sticker.PendingPath(filepath.Join(*dataPathPtr, "pending")),
+		sticker.DiskQuota(int64(config.DiskQuotaMB)<<20),
+	)
+	if err != nil {
+		log.Fatalln("Failed to collect the sticker info:", err)
+	}
+	statsRecorder, err := stats.Open(filepath.Join(*dataPathPtr, "stats.jsonl"))
+	if err != nil {
+		log.Fatalln("Failed to load the usage statistics:", err)
+	}
+	defer statsRecorder.Close()
+	recentPath := ""
+	if config.PersistRecentHistory {
+		recentPath = filepath.Join(*dataPathPtr, "recent.json")
+	}
+	recent, err := userdata.NewRecent(config.RecentHistorySize, recentPath)
+	if err != nil {
+		log.Fatalln("Failed to load the recent history:", err)
+	}
+	defer func() {
+		if err := recent.Save(); err != nil {
+			log.Println("Failed to save the recent history:", err)
+		}
+	}()
+	ut := &usageTracker{stats: statsRecorder, recent: recent}
+
+	al, err := audit.Open(filepath.Join(*dataPathPtr, "audit.jsonl"))
+	if err != nil {
+		log.Fatalln("Failed to load the audit log:", err)
+	}
+	defer al.Close()
+	qc := &quotaChecker{al: al, gc: &gcPtr, maxOwned: config.MaxOwnedStickers}
+
+	undoWindow := time.Duration(config.UndoWindow) * time.Second
+	// doUndo checks the permissions of undoing the change of target, which is empty for the user of h.
+	doUndo := func(h handler, target string) {
+		if undoWindow == 0 {
+			h.replyPrivate("Undo is disabled.")
+			return
+		}
+		if target == "" {
+			target = h.userID()
+		}
+		if target != h.userID() && !gcPtr.Load().checkPermission(h, "undo-any") {
+			return
 		}
+		handleUndo(h, sm, al, target, undoWindow)
 	}
-	gcMgr := newGuildConfigManager(
-		guildConfig{
-			coolDown:        time.Duration(config.CoolDown) * time.Second,
-			coolDownMessage: config.CoolDownMessage,
-		},
-		perGuildConfig,
-	)
-
-	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile | log.Lmsgprefix)
-
-	log.Println("Starting...")
-	log.Println("\tresource directory =", *resourcePathPtr)
-	log.Println("\tconfig file        =", *configFilePathPtr)
-	log.Println("\t\tcommand prefix     =", commandPrefix)
-	log.Println("\t\tcase sensitive     =", config.CaseSensitive)
-	log.Println("\t\tper guild config   =", perGuildConfig)
-
-	rand.Seed(time.Now().UnixNano())
 
-	sm, err := sticker.NewManager(*resourcePathPtr, sticker.CaseSensitive(config.CaseSensitive))
+	favs, err := userdata.OpenFavorites(filepath.Join(*dataPathPtr, "favorites.json"))
 	if err != nil {
-		log.Fatalln("Failed to collect the sticker info:", err)
+		log.Fatalln("Failed to load the favorites:", err)
 	}
 
 	s, err := discordgo.New("Bot " + strings.TrimSpace(string(config.Token)))
@@ -550,25 +1912,44 @@ func main() {
 		if m.Author.ID == s.State.User.ID {
 			return
 		}
+		gcMgr := gcPtr.Load()
 
-		// Only handle messages with certain prefix.
-		if !strings.HasPrefix(m.Content, commandPrefix) {
+		// Only handle messages with the prefixes of the guild.
+		prefix, ok := gcMgr.matchPrefix(m.GuildID, m.Content)
+		if !ok {
 			return
 		}
 
 		h := &messageHandler{s: s, m: m}
 
-		command := strings.TrimSpace(m.Content[len(commandPrefix):])
+		command := strings.TrimSpace(m.Content[len(prefix):])
 		if command == "" {
 			command = "/help"
 		}
 
+		// Repost the last sticker of the user, e.g. "!!!" with the default prefix.
+		if command == "!" {
+			if !gcMgr.checkCommand(h, "post") {
+				return
+			}
+			if gcMgr.tryCoolDown(h) {
+				handleRepost(h, sm, ut)
+			}
+			return
+		}
+
 		// Non-command case.
 		if command[0] != '/' {
-			if succ, msg := gcMgr.tryCoolDown(m.ChannelID, m.GuildID); succ {
-				handlePost(h, sm, command, nil)
-			} else {
-				h.replyPublic(msg)
+			if !gcMgr.checkCommand(h, "post") {
+				return
+			}
+			pattern, opts, err := parsePostArgs(command)
+			if err != nil {
+				h.replyPublic(err.Error())
+				return
+			}
+			if gcMgr.tryCoolDown(h) {
+				handlePost(h, sm, ut, pattern, opts, nil)
 			}
 			return
 		}
@@ -576,38 +1957,56 @@ func main() {
 		command, arg, _ := strings.Cut(command[1:], " ")
 
 		var matchedCommands []string
-		for _, comm := range []string{"help", "list", "add", "txt-add", "rename", "random"} {
-			if strings.HasPrefix(comm, command) {
+		for _, comm := range commandNames {
+			if !slices.Contains(actionNames, comm) && strings.HasPrefix(comm, command) {
 				matchedCommands = append(matchedCommands, comm)
 			}
 		}
 		if len(matchedCommands) > 1 {
 			for i, comm := range matchedCommands {
-				matchedCommands[i] = fmt.Sprintf("`%s/%s`", commandPrefix, comm)
+				matchedCommands[i] = fmt.Sprintf("`%s/%s`", prefix, comm)
 			}
 			h.replyPublic("Matched more then 1 commands: " + strings.Join(matchedCommands, ", "))
 			return
 		}
 		if len(matchedCommands) < 1 {
-			h.replyPrivate(fmt.Sprintf("Unknown command `%s/%s`. Run `%s/help` to see the supported commands.\n", commandPrefix, command, commandPrefix))
+			h.replyPrivate(fmt.Sprintf("Unknown command `%s/%s`. Run `%s/help` to see the supported commands.\n", prefix, command, prefix))
+			return
+		}
+
+		if !gcMgr.checkCommand(h, matchedCommands[0]) {
 			return
 		}
 
 		switch matchedCommands[0] {
 		case "help":
-			handleHelp(h, false)
+			handleHelp(h, gcMgr.prefixes(m.GuildID), false)
 		case "list":
-			handleList(h, sm, arg)
+			patterns, category, err := splitCategory(arg)
+			if err != nil {
+				h.replyPrivate(err.Error())
+				return
+			}
+			handleList(h, sm, patterns, category)
+		case "categories":
+			handleCategories(h, sm)
 		case "add":
-			args := strings.Fields(arg)
-			if len(args) != 2 {
-				h.replyPublic("Invalid format. Expect `" + commandPrefix + "/add <sticker_name> <URL>`.")
+			rest, category, err := splitCategory(arg)
+			args := strings.Fields(rest)
+			if err != nil || len(args) != 2 {
+				h.replyPublic("Invalid format. Expect `" + prefix + "/add <sticker_name> <URL> [@<category>]`.")
 				return
 			}
-			handleAdd(h, sm, args[0], args[1])
+			if ch := gcMgr.reviewChannel(h); ch != "" {
+				handleSubmit(h, s, sm, al, qc, ch, args[1], func(d *sticker.Download) (*sticker.Pending, error) {
+					return sm.SubmitSticker(args[0], category, d, h.userID())
+				})
+			} else {
+				handleAdd(h, sm, al, qc, args[0], category, args[1])
+			}
 		case "txt-add":
 			arg = strings.TrimSpace(arg)
-			var name, text string
+			var name, category, text string
 			for i, r := range arg {
 				if unicode.IsSpace(r) {
 					name = string(arg[:i])
@@ -615,24 +2014,154 @@ func main() {
 					break
 				}
 			}
+			if c, rest, ok := strings.Cut(text, " "); ok && len(c) > 1 && c[0] == '@' {
+				category, text = c[1:], rest
+			}
+			text = strings.TrimSpace(text)
 			if name == "" || text == "" {
-				h.replyPublic("Invalid format. Expect `" + commandPrefix + "/txt-add <sticker_name> <text>`.")
+				h.replyPublic("Invalid format. Expect `" + prefix + "/txt-add <sticker_name> [@<category>] <text>`.")
 				return
 			}
-			text = strings.TrimSpace(text)
-			handleAddText(h, sm, name, text)
+			if ch := gcMgr.reviewChannel(h); ch != "" {
+				handleSubmit(h, s, sm, al, qc, ch, "", func(*sticker.Download) (*sticker.Pending, error) {
+					return sm.SubmitText(name, category, text, h.userID())
+				})
+			} else {
+				handleAddText(h, sm, al, qc, name, category, text)
+			}
 		case "rename":
-			args := strings.Fields(arg)
-			if len(args) != 2 {
-				h.replyPublic("Invalid format. Expect `" + commandPrefix + "/rename <sticker_name> <new_sticker_name>.`")
+			rest, category, err := splitCategory(arg)
+			args := strings.Fields(rest)
+			// A bare `@` moves the sticker directly under the root instead of keeping its category.
+			if i := slices.Index(args, "@"); i >= 0 && category == "" {
+				args, category = slices.Delete(args, i, i+1), sticker.RootCategory
+			}
+			if err != nil || len(args) != 2 {
+				h.replyPublic("Invalid format. Expect `" + prefix + "/rename <sticker_name> <new_sticker_name> [@<category>]`.")
 				return
 			}
-			handleRename(h, sm, args[0], args[1])
+			handleRename(h, sm, al, qc, args[0], args[1], category)
 		case "random":
-			if succ, msg := gcMgr.tryCoolDown(m.ChannelID, m.GuildID); succ {
-				handleRandom(h, sm, arg)
-			} else {
-				h.replyPublic(msg)
+			patterns, category, err := splitCategory(arg)
+			if err != nil {
+				h.replyPublic(err.Error())
+				return
+			}
+			if gcMgr.tryCoolDown(h) {
+				handleRandom(h, sm, ut, patterns, category)
+			}
+		case "stats":
+			handleStats(h, sm, ut, arg)
+		case "top":
+			n, global, since := defaultTopCount, false, time.Duration(0)
+			args := strings.Fields(arg)
+			for i := 0; i < len(args); i++ {
+				switch args[i] {
+				case "--guild":
+					global = false
+				case "--global":
+					global = true
+				case "--since":
+					if i+1 >= len(args) {
+						h.replyPublic("Invalid format. Expect `" + prefix + "/top [<n>] [--guild|--global] [--since <duration>]`.")
+						return
+					}
+					i++
+					d, err := parseSince(args[i])
+					if err != nil {
+						h.replyPublic(err.Error())
+						return
+					}
+					since = d
+				default:
+					v, err := strconv.Atoi(args[i])
+					if err != nil || v <= 0 {
+						h.replyPublic("Invalid format. Expect `" + prefix + "/top [<n>] [--guild|--global] [--since <duration>]`.")
+						return
+					}
+					n = v
+				}
+			}
+			handleTop(h, sm, ut, n, global, since)
+		case "recent":
+			handleRecent(h, sm, ut)
+		case "history":
+			handleHistory(h, sm, al, arg)
+		case "usage":
+			handleUsage(h, sm)
+		case "nsfw":
+			nsfw := true
+			var words []string
+			for _, w := range strings.Fields(arg) {
+				if w == "--off" {
+					nsfw = false
+				} else {
+					words = append(words, w)
+				}
+			}
+			handleNSFW(h, sm, al, strings.Join(words, " "), nsfw)
+		case "undo":
+			target := ""
+			if strings.TrimSpace(arg) != "" {
+				id, ok := parseUserMention(arg)
+				if !ok {
+					h.replyPublic("Invalid format. Expect `" + prefix + "/undo [<user>]`.")
+					return
+				}
+				target = id
+			}
+			doUndo(h, target)
+		case "fav":
+			sub, subArg, _ := strings.Cut(strings.TrimSpace(arg), " ")
+			subArg = strings.TrimSpace(subArg)
+			switch sub {
+			case "add":
+				handleFavAdd(h, sm, favs, subArg)
+			case "remove":
+				handleFavRemove(h, sm, favs, subArg)
+			case "list":
+				handleFavList(h, sm, favs)
+			case "":
+				h.replyPublic("Invalid format. Expect `" + prefix + "/fav add <pattern>... | remove <pattern>...|<n> | list | <n> | random`.")
+			default:
+				if gcMgr.tryCoolDown(h) {
+					handleFavPost(h, sm, ut, favs, sub)
+				}
+			}
+		case "config":
+			sub, rest, _ := strings.Cut(strings.TrimSpace(arg), " ")
+			rest = strings.TrimSpace(rest)
+			switch sub {
+			case "", "get":
+				handleConfigGet(h, gcMgr)
+			case "set":
+				key, value, _ := strings.Cut(rest, " ")
+				if key == "" {
+					h.replyPublic("Invalid format. Expect `" + prefix + "/config set <key> <value>`.")
+					return
+				}
+				handleConfigSet(h, gcMgr, key, strings.TrimSpace(value), false)
+			case "reset":
+				if rest == "" {
+					h.replyPublic("Invalid format. Expect `" + prefix + "/config reset <key>`.")
+					return
+				}
+				handleConfigSet(h, gcMgr, rest, "", true)
+			default:
+				h.replyPublic("Invalid format. Expect `" + prefix + "/config [get | set <key> <value> | reset <key>]`.")
+			}
+		case "combo":
+			grid := false
+			var words []string
+			for _, w := range strings.Fields(arg) {
+				if w == "--grid" {
+					grid = true
+				} else {
+					words = append(words, w)
+				}
+			}
+			if gcMgr.tryCoolDown(h) {
+				handleCombo(h, sm, ut, strings.Split(strings.Join(words, " "), "+"), grid)
 			}
 		default:
 			panic("Should not go here")
@@ -641,6 +2170,7 @@ func main() {
 
 	s.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		h := &commandHandler{s: s, i: i}
+		gcMgr := gcPtr.Load()
 		switch i.Type {
 		case discordgo.InteractionApplicationCommand:
 			if i.ApplicationCommandData().Name != "sticker" {
@@ -663,68 +2193,165 @@ func main() {
 				return ""
 			}
 
+			if !gcMgr.checkCommand(h, data.Name) {
+				return
+			}
+
 			switch data.Name {
 			case "help":
-				handleHelp(h, true)
+				handleHelp(h, gcMgr.prefixes(i.GuildID), true)
 			case "list":
-				handleList(h, sm, getOptionString("patterns"))
+				handleList(h, sm, getOptionString("patterns"), getOptionString("category"))
+			case "categories":
+				handleCategories(h, sm)
 			case "add":
-				handleAdd(h, sm, getOptionString("name"), getOptionString("url"))
+				name, category, url := getOptionString("name"), getOptionString("category"), getOptionString("url")
+				if ch := gcMgr.reviewChannel(h); ch != "" {
+					handleSubmit(h, s, sm, al, qc, ch, url, func(d *sticker.Download) (*sticker.Pending, error) {
+						return sm.SubmitSticker(name, category, d, h.userID())
+					})
+				} else {
+					handleAdd(h, sm, al, qc, name, category, url)
+				}
 			case "txt-add":
-				handleAddText(h, sm, getOptionString("name"), strings.TrimSpace(getOptionString("text")))
+				name, category, text := getOptionString("name"), getOptionString("category"), strings.TrimSpace(getOptionString("text"))
+				if ch := gcMgr.reviewChannel(h); ch != "" {
+					handleSubmit(h, s, sm, al, qc, ch, "", func(*sticker.Download) (*sticker.Pending, error) {
+						return sm.SubmitText(name, category, text, h.userID())
+					})
+				} else {
+					handleAddText(h, sm, al, qc, name, category, text)
+				}
 			case "rename":
-				handleRename(h, sm, getOptionString("name"), getOptionString("new_name"))
+				handleRename(h, sm, al, qc, getOptionString("name"), getOptionString("new_name"), getOptionString("category"))
 			case "random":
-				if succ, msg := gcMgr.tryCoolDown(i.ChannelID, i.GuildID); succ {
-					handleRandom(h, sm, getOptionString("patterns"))
-				} else {
-					h.replyPublic(msg)
+				if gcMgr.tryCoolDown(h) {
+					handleRandom(h, sm, ut, getOptionString("patterns"), getOptionString("category"))
 				}
-			case "post":
-				if succ, msg := gcMgr.tryCoolDown(i.ChannelID, i.GuildID); !succ {
-					h.replyPublic(msg)
+			case "stats":
+				handleStats(h, sm, ut, getOptionString("patterns"))
+			case "top":
+				n := defaultTopCount
+				since := time.Duration(0)
+				for _, o := range data.Options {
+					if o.Name == "count" {
+						n = int(o.IntValue())
+					}
+				}
+				if v := getOptionString("since"); v != "" {
+					d, err := parseSince(v)
+					if err != nil {
+						h.replyPrivate(err.Error())
+						return
+					}
+					since = d
+				}
+				handleTop(h, sm, ut, n, getOptionString("scope") == "global", since)
+			case "recent":
+				handleRecent(h, sm, ut)
+			case "history":
+				handleHistory(h, sm, al, getOptionString("patterns"))
+			case "usage":
+				handleUsage(h, sm)
+			case "nsfw":
+				nsfw := true
+				for _, o := range data.Options {
+					if o.Name == "flagged" {
+						nsfw = o.BoolValue()
+					}
+				}
+				handleNSFW(h, sm, al, getOptionString("pattern"), nsfw)
+			case "undo":
+				target := ""
+				for _, o := range data.Options {
+					if o.Name == "user" {
+						target = o.UserValue(nil).ID
+					}
+				}
+				doUndo(h, target)
+			case "fav":
+				if len(data.Options) != 1 {
+					h.replyPrivate("Invalid command format, please contact the admin")
 					return
 				}
-				handlePost(h, sm, getOptionString("pattern"), func(ss []*sticker.Sticker) {
-					const (
-						maxRowCount    = 5
-						maxColumnCount = 5
-					)
-					var buttons []discordgo.MessageComponent
-					for i, s := range ss {
-						if i%2 == 0 {
-							buttons = append(buttons, discordgo.Button{
-								Label:    s.Name(),
-								Style:    discordgo.PrimaryButton,
-								Disabled: false,
-								CustomID: s.Path(),
-							})
-						} else {
-							buttons = append(buttons, discordgo.Button{
-								Label:    s.Name(),
-								Style:    discordgo.SecondaryButton,
-								Disabled: false,
-								CustomID: s.Path(),
-							})
+				sub := data.Options[0]
+				subOptionString := func(name string) string {
+					for _, o := range sub.Options {
+						if o.Name == name {
+							return o.StringValue()
 						}
 					}
-					for compBegin := 0; compBegin < len(buttons); compBegin += maxRowCount * maxColumnCount {
-						compEnd := compBegin + maxRowCount*maxColumnCount
-						if compEnd > len(buttons) {
-							compEnd = len(buttons)
+					return ""
+				}
+				switch sub.Name {
+				case "add":
+					handleFavAdd(h, sm, favs, subOptionString("pattern"))
+				case "remove":
+					handleFavRemove(h, sm, favs, subOptionString("target"))
+				case "list":
+					handleFavList(h, sm, favs)
+				case "post", "random":
+					arg := "random"
+					if sub.Name == "post" {
+						arg = strconv.FormatInt(sub.Options[0].IntValue(), 10)
+					}
+					if gcMgr.tryCoolDown(h) {
+						handleFavPost(h, sm, ut, favs, arg)
+					}
+				default:
+					panic("Should not go here")
+				}
+			case "config":
+				if len(data.Options) != 1 {
+					h.replyPrivate("Invalid command format, please contact the admin")
+					return
+				}
+				sub := data.Options[0]
+				subOptionString := func(name string) string {
+					for _, o := range sub.Options {
+						if o.Name == name {
+							return o.StringValue()
 						}
-						content := fmt.Sprintf("Showing %d ~ %d matched stickers:", compBegin+1, compEnd)
-						var components []discordgo.MessageComponent
-						for rowBegin := compBegin; rowBegin < compEnd; rowBegin += maxColumnCount {
-							rowEnd := rowBegin + maxColumnCount
-							if rowEnd > compEnd {
-								rowEnd = compEnd
-							}
-							components = append(components, discordgo.ActionsRow{Components: buttons[rowBegin:rowEnd]})
+					}
+					return ""
+				}
+				switch sub.Name {
+				case "get":
+					handleConfigGet(h, gcMgr)
+				case "set":
+					handleConfigSet(h, gcMgr, subOptionString("key"), strings.TrimSpace(subOptionString("value")), false)
+				case "reset":
+					handleConfigSet(h, gcMgr, subOptionString("key"), "", true)
+				default:
+					panic("Should not go here")
+				}
+			case "combo":
+				if gcMgr.tryCoolDown(h) {
+					handleCombo(h, sm, ut, strings.Split(getOptionString("stickers"), "+"), getOptionString("layout") == "grid")
+				}
+			case "post":
+				opts, err := commandPostOptions(data.Options)
+				if err != nil {
+					h.replyPrivate(err.Error())
+					return
+				}
+				if !gcMgr.tryCoolDown(h) {
+					return
+				}
+				handlePost(h, sm, ut, getOptionString("pattern"), opts, func(ss []*sticker.Sticker) {
+					for _, s := range ss {
+						if len(encodePostButtonID(s.ID(), opts)) > maxCustomIDLen {
+							h.replyPublic("Found more than one stickers! The options are too long to be attached to buttons, please provide more specific patterns. Matched: " + sticker.StickerListString(ss))
+							gcMgr.removeCoolDown(h)
+							return
 						}
-						h.reply(content, true, components)
 					}
-					gcMgr.removeCoolDown(i.ChannelID)
+					for begin := 0; begin < len(ss); begin += maxButtonsPerMessage {
+						end := min(begin+maxButtonsPerMessage, len(ss))
+						content := fmt.Sprintf("Showing %d ~ %d matched stickers:", begin+1, end)
+						h.reply(content, true, postButtons(ss[begin:end], opts))
+					}
+					gcMgr.removeCoolDown(h)
 				})
 			default:
 				panic("Should not go here")
@@ -748,29 +2375,57 @@ func main() {
 			// The further responses shall be sent as followup message.
 			h.replied = true
 
-			if succ, msg := gcMgr.tryCoolDown(i.ChannelID, i.GuildID); !succ {
-				if i.Member != nil {
-					msg = i.Member.Mention() + " clicked button: " + msg
+			if approve, pendingID, ok := decodeReviewButtonID(i.MessageComponentData().CustomID); ok {
+				if gcMgr.checkCommand(h, "review") {
+					handleReview(h, sm, al, approve, pendingID)
 				}
-				if _, err := s.ChannelMessageSendComplex(i.ChannelID, &discordgo.MessageSend{
-					Content:         msg,
-					AllowedMentions: &discordgo.MessageAllowedMentions{},
-				}); err != nil {
-					log.Println("Failed to sent cooling down message:", err)
-					h.replyPrivate("Something goes wrong here! Please contact the admin.")
+				return
+			}
+
+			if !gcMgr.checkCommand(h, "post") {
+				return
+			}
+			id, opts, err := decodePostButtonID(i.MessageComponentData().CustomID)
+			if err != nil {
+				log.Println("Failed to decode the button:", err)
+				h.replyPrivate("Something goes wrong here! Please contact the admin.")
+				return
+			}
+			if !gcMgr.tryCoolDown(h) {
+				return
+			}
+
+			// Only the lookup holds the lock, so that a slow upload doesn't block the changes to the library.
+			st := func() *sticker.Sticker {
+				sm.RLock()
+				defer sm.RUnlock()
+				st := sm.StickerByID(id)
+				if st == nil {
+					// The buttons created before the sticker IDs were introduced carry the path.
+					st = sm.StickerByPath(id)
 				}
+				if st == nil {
+					return nil
+				}
+				return copySticker(st)
+			}()
+			if st == nil {
+				h.replyPrivate("The sticker no longer exists. Please search it again.")
+				return
+			}
+			if st.NSFW() && !h.nsfwChannel() {
+				h.replyPrivate(nsfwRefusalMsg)
 				return
 			}
 
-			path := i.MessageComponentData().CustomID
-			ext := filepath.Ext(path)
+			ext := st.Ext()
 			content := ""
 			if i.Member != nil {
 				content = i.Member.Mention() + " posted:"
 			}
 
 			if ext == ".txt" {
-				text, err := os.ReadFile(path)
+				text, err := os.ReadFile(st.Path())
 				if err != nil {
 					log.Println("Failed to read the text:", err)
 					h.replyPrivate("Something goes wrong here! Please contact the admin.")
@@ -783,14 +2438,19 @@ func main() {
 				}); err != nil {
 					log.Println("Failed to post text:", err)
 					h.replyPrivate("Something goes wrong here! Please contact the admin.")
+					return
 				}
+				ut.posted(h, st)
 				return
 			}
 
-			r, err := os.Open(path)
+			r, ext, err := openSticker(st.Path(), opts)
 			if err != nil {
-				log.Println("Failed to open the image:", err)
-				h.replyPrivate("Something goes wrong here! Please contact the admin.")
+				if err != sticker.UninformableErr {
+					h.replyPrivate(err.Error())
+				} else {
+					h.replyPrivate("Something goes wrong here! Please contact the admin.")
+				}
 				return
 			}
 			defer r.Close()
@@ -808,9 +2468,22 @@ func main() {
 				h.replyPrivate("Something goes wrong here! Please contact the admin.")
 				return
 			}
+			ut.posted(h, st)
 		}
 	})
 
+	minScaleOptionValue := float64(minPostScale)
+	minSpeedOptionValue := float64(minPostSpeed)
+	minLoopOptionValue := float64(0)
+	minTopCountOptionValue := float64(1)
+	minFavNumberOptionValue := float64(1)
+	var settingChoices []*discordgo.ApplicationCommandOptionChoice
+	for _, key := range guildSettingKeys {
+		settingChoices = append(settingChoices, &discordgo.ApplicationCommandOptionChoice{Name: key, Value: key})
+	}
+	// DefaultMemberPermissions is left unset since the command also hosts posting, which everyone should be able to do.
+	// The mutating sub-commands are guarded by the Permissions config instead.
+	// DMs are still allowed; The owners and the users listed in the default rules can manage the stickers from there.
 	if _, err := s.ApplicationCommandCreate(config.AppID, "", &discordgo.ApplicationCommand{
 		Name:        "sticker",
 		Description: "Discord sticker command",
@@ -823,6 +2496,70 @@ func main() {
 				Name:        "pattern",
 				Required:    true,
 				Description: "The search pattern of the sticker",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "caption",
+				Required:    false,
+				Description: "The text drawn on the image",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "caption_position",
+				Required:    false,
+				Description: "Where the caption is drawn, bottom by default",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "top", Value: "top"},
+					{Name: "bottom", Value: "bottom"},
+				},
+			}, {
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "mirror",
+				Required:    false,
+				Description: "Flip the image horizontally",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "flip",
+				Required:    false,
+				Description: "Flip the image vertically",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "rotate",
+				Required:    false,
+				Description: "Rotate the image clockwise",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "90", Value: 90},
+					{Name: "180", Value: 180},
+					{Name: "270", Value: 270},
+				},
+			}, {
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "gray",
+				Required:    false,
+				Description: "Make the image grayscale",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionNumber,
+				Name:        "scale",
+				Required:    false,
+				Description: "Resize the image by the factor",
+				MinValue:    &minScaleOptionValue,
+				MaxValue:    maxPostScale,
+			}, {
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "reverse",
+				Required:    false,
+				Description: "Play the GIF backwards",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionNumber,
+				Name:        "speed",
+				Required:    false,
+				Description: "Change the playback speed of the GIF by the factor",
+				MinValue:    &minSpeedOptionValue,
+				MaxValue:    maxPostSpeed,
+			}, {
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "loop",
+				Required:    false,
+				Description: "How many times the GIF is played, 0 for looping forever",
+				MinValue:    &minLoopOptionValue,
 			}},
 		}, {
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
@@ -837,7 +2574,16 @@ func main() {
 				Name:        "patterns",
 				Required:    false,
 				Description: "The search patterns separated by slashes",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "category",
+				Required:    false,
+				Description: "Only list the stickers in the category",
 			}},
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "categories",
+			Description: "Show the categories",
 		}, {
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
 			Name:        "add",
@@ -852,6 +2598,11 @@ func main() {
 				Name:        "url",
 				Required:    true,
 				Description: "A link to download the sticker",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "category",
+				Required:    false,
+				Description: "The category to put the sticker in, sub-categories separated by slashes",
 			}},
 		}, {
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
@@ -867,6 +2618,11 @@ func main() {
 				Name:        "text",
 				Required:    true,
 				Description: "The text content",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "category",
+				Required:    false,
+				Description: "The category to put the text in, sub-categories separated by slashes",
 			}},
 		}, {
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
@@ -881,7 +2637,12 @@ func main() {
 				Type:        discordgo.ApplicationCommandOptionString,
 				Name:        "new_name",
 				Required:    true,
-				Description: "A link to download the sticker",
+				Description: "New sticker name",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "category",
+				Required:    false,
+				Description: "The category to move the sticker to, or / for the root; The category is kept if not given",
 			}},
 		}, {
 			Type:        discordgo.ApplicationCommandOptionSubCommand,
@@ -890,9 +2651,191 @@ func main() {
 			Options: []*discordgo.ApplicationCommandOption{{
 				Type:        discordgo.ApplicationCommandOptionString,
 				Name:        "patterns",
+				Required:    false,
+				Description: "The search patterns separated by slashes",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "category",
+				Required:    false,
+				Description: "Only choose from the stickers in the category",
+			}},
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "stats",
+			Description: "Show how many times the stickers have been posted",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "patterns",
+				Required:    false,
+				Description: "The search patterns separated by slashes",
+			}},
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "top",
+			Description: "Show the most posted stickers",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "count",
+				Required:    false,
+				Description: "How many stickers to show",
+				MinValue:    &minTopCountOptionValue,
+			}, {
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "scope",
+				Required:    false,
+				Description: "Count the posts in this guild or in all guilds, this guild by default",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "guild", Value: "guild"},
+					{Name: "global", Value: "global"},
+				},
+			}, {
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "since",
+				Required:    false,
+				Description: "Only count the posts in the duration, e.g. 7d or 12h",
+			}},
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "recent",
+			Description: "Show the stickers you posted recently",
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "usage",
+			Description: "Show the disk usage of the stickers",
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "nsfw",
+			Description: "Mark a sticker as NSFW, which can only be posted in age-restricted channels",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "pattern",
 				Required:    true,
+				Description: "The search patterns of the sticker",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "flagged",
+				Required:    false,
+				Description: "Whether the sticker is NSFW, true by default",
+			}},
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "undo",
+			Description: "Revert your most recent change of the stickers",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Required:    false,
+				Description: "Revert the change of another user instead, which needs the permission",
+			}},
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "history",
+			Description: "Show who added, renamed or reviewed the stickers",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "patterns",
+				Required:    false,
 				Description: "The search patterns separated by slashes",
 			}},
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+			Name:        "fav",
+			Description: "Manage and post your favorite stickers",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "add",
+				Description: "Add a sticker to your favorites",
+				Options: []*discordgo.ApplicationCommandOption{{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "pattern",
+					Required:    true,
+					Description: "The search pattern of the sticker",
+				}},
+			}, {
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Remove a sticker from your favorites",
+				Options: []*discordgo.ApplicationCommandOption{{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "target",
+					Required:    true,
+					Description: "The number in your favorites or the search pattern of the sticker",
+				}},
+			}, {
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "Show your favorites",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "post",
+				Description: "Post a sticker in your favorites",
+				Options: []*discordgo.ApplicationCommandOption{{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "number",
+					Required:    true,
+					Description: "The number in your favorites",
+					MinValue:    &minFavNumberOptionValue,
+				}},
+			}, {
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "random",
+				Description: "Post a random sticker in your favorites",
+			}},
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+			Name:        "config",
+			Description: "View or change the settings of this guild",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "get",
+				Description: "Show the settings of this guild",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "set",
+				Description: "Change a setting of this guild",
+				Options: []*discordgo.ApplicationCommandOption{{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "key",
+					Required:    true,
+					Description: "The setting to change",
+					Choices:     settingChoices,
+				}, {
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "value",
+					Required:    true,
+					Description: "The new value",
+				}},
+			}, {
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "reset",
+				Description: "Restore a setting to the value in the config file",
+				Options: []*discordgo.ApplicationCommandOption{{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "key",
+					Required:    true,
+					Description: "The setting to restore",
+					Choices:     settingChoices,
+				}},
+			}},
+		}, {
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "combo",
+			Description: "Combine several stickers into one still image",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "stickers",
+				Required:    true,
+				Description: "The search patterns of the stickers separated by plus signs",
+			}, {
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "layout",
+				Required:    false,
+				Description: "How the stickers are laid out, horizontal by default",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "horizontal", Value: "horizontal"},
+					{Name: "grid", Value: "grid"},
+				},
+			}},
 		}},
 	}); err != nil {
 		log.Fatalln("Failed to create app command, err:", err)
@@ -919,7 +2862,42 @@ func main() {
 	log.Println("Bot is running now. Press CTRL-C to exit.")
 	shutdownCh := make(chan os.Signal, 1)
 	signal.Notify(shutdownCh, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+
+	// reloadConfig applies the new guild configs and owners, keeping the cooldowns.
+	// The old config is kept if the new one is invalid.
+	reloadConfig := func() {
+		next, err := readConfig(*configFilePathPtr)
+		if err == nil {
+			err = next.validate()
+		}
+		if err != nil {
+			log.Printf("Failed to reload the config, keeping the old one:\n%v", err)
+			return
+		}
+		for _, name := range next.restartOnlyChanges(config) {
+			log.Printf("%s is changed but only takes effect after a restart", name)
+		}
+		defaultConfig, perGuildConfig := next.guildConfigs()
+		cur := gcPtr.Load()
+		gcPtr.Store(newGuildConfigManager(defaultConfig, perGuildConfig, overrides, next.Owners, cur.cdCounter, cur.limiter))
+		log.Println("Reloaded the config")
+		log.Println("\t\tcommand prefixes   =", defaultConfig.prefixes)
+		log.Println("\t\towners             =", next.Owners)
+		log.Println("\t\tpermissions        =", next.Permissions)
+		log.Println("\t\tdaily quotas       =", next.DailyQuotaPerUser, "per user,", next.DailyQuotaPerGuild, "per guild")
+		log.Println("\t\tper guild config   =", perGuildConfig)
+	}
 
-	<-shutdownCh
+loop:
+	for {
+		select {
+		case <-reloadCh:
+			reloadConfig()
+		case <-shutdownCh:
+			break loop
+		}
+	}
 	log.Println("Bye~")
 }
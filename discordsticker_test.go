@@ -0,0 +1,400 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"discordsticker/internal/clocktest"
+	"discordsticker/stats"
+	"discordsticker/sticker"
+	"discordsticker/userdata"
+	"discordsticker/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// testHandler is a handler recording the replies instead of sending them.
+type testHandler struct {
+	user, guild, channel string
+	roles                []string
+	nsfw                 bool
+
+	replies []string
+}
+
+func (h *testHandler) userInfo() string      { return "[User: ID=" + h.user + "]" }
+func (h *testHandler) userID() string        { return h.user }
+func (h *testHandler) guildID() string       { return h.guild }
+func (h *testHandler) channelID() string     { return h.channel }
+func (h *testHandler) memberRoles() []string { return h.roles }
+func (h *testHandler) nsfwChannel() bool     { return h.nsfw }
+
+func (h *testHandler) postSticker(poster io.Reader, ext string) error {
+	h.replies = append(h.replies, "posted "+ext)
+	return nil
+}
+
+func (h *testHandler) replyPrivate(msg string) { h.replies = append(h.replies, msg) }
+func (h *testHandler) replyPublic(msg string)  { h.replies = append(h.replies, msg) }
+
+func (h *testHandler) replyComponents(msg string, components []discordgo.MessageComponent) {
+	h.replies = append(h.replies, msg)
+}
+
+func (h *testHandler) replyCoolDown(msg, notice string, life time.Duration) {
+	h.replies = append(h.replies, msg)
+}
+
+// newTestGuildConfigManager creates a manager with the overrides kept in a temporary file.
+func newTestGuildConfigManager(t *testing.T, defaultConfig guildConfig, perGuildConfig map[string]guildConfig, owners ...string) *guildConfigManager {
+	t.Helper()
+	overrides, err := openGuildOverrides(filepath.Join(t.TempDir(), "guild_config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newGuildConfigManager(defaultConfig, perGuildConfig, overrides, owners, utils.NewCoolDownCounter(), utils.NewRateLimiter(utils.RealClock{}))
+}
+
+func TestTryCoolDown(t *testing.T) {
+	tests := []struct {
+		name string
+		conf guildConfig
+		// blocked and free are handlers acting after the one of u1 in c1 of g1.
+		blocked, free []*testHandler
+	}{
+		{
+			name:    "channel",
+			conf:    guildConfig{coolDown: 5 * time.Second, coolDownScope: "channel"},
+			blocked: []*testHandler{{user: "u2", guild: "g1", channel: "c1"}},
+			free:    []*testHandler{{user: "u1", guild: "g1", channel: "c2"}, {user: "u1", guild: "g2", channel: "c3"}},
+		},
+		{
+			name:    "user",
+			conf:    guildConfig{coolDown: 5 * time.Second, coolDownScope: "user"},
+			blocked: []*testHandler{{user: "u1", guild: "g1", channel: "c2"}},
+			free:    []*testHandler{{user: "u2", guild: "g1", channel: "c1"}, {user: "u1", guild: "g2", channel: "c3"}},
+		},
+		{
+			name:    "guild",
+			conf:    guildConfig{coolDown: 5 * time.Second, coolDownScope: "guild"},
+			blocked: []*testHandler{{user: "u2", guild: "g1", channel: "c2"}},
+			free:    []*testHandler{{user: "u1", guild: "g2", channel: "c3"}},
+		},
+		{
+			name:    "user+channel",
+			conf:    guildConfig{coolDown: 5 * time.Second, coolDownScope: "user+channel"},
+			blocked: []*testHandler{{user: "u1", guild: "g1", channel: "c1"}},
+			free:    []*testHandler{{user: "u1", guild: "g1", channel: "c2"}, {user: "u2", guild: "g1", channel: "c1"}},
+		},
+		{
+			name: "DM",
+			conf: guildConfig{coolDown: 5 * time.Second, coolDownScope: "user"},
+			free: []*testHandler{{user: "u1", channel: "dm"}},
+		},
+		{
+			name: "disabled",
+			conf: guildConfig{coolDownScope: "channel"},
+			free: []*testHandler{{user: "u2", guild: "g1", channel: "c1"}},
+		},
+		{
+			name:    "rate limit",
+			conf:    guildConfig{coolDown: time.Hour, coolDownScope: "channel", rateLimit: rateLimit{Rate: 2, Period: 10}},
+			free:    []*testHandler{{user: "u2", guild: "g1", channel: "c1"}},
+			blocked: []*testHandler{{user: "u3", guild: "g1", channel: "c1"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := clocktest.NewClock(time.Unix(0, 0))
+			gc := newTestGuildConfigManager(t, tc.conf, nil)
+			gc.cdCounter = utils.NewCoolDownCounterWithClock(clock)
+			gc.limiter = utils.NewRateLimiter(clock)
+
+			if !gc.tryCoolDown(&testHandler{user: "u1", guild: "g1", channel: "c1"}) {
+				t.Fatal("the first post is cooling down")
+			}
+			// free runs first so that the rate limit is used up by it.
+			for _, h := range tc.free {
+				if !gc.tryCoolDown(h) {
+					t.Errorf("%+v is cooling down", h)
+				}
+			}
+			for _, h := range tc.blocked {
+				if gc.tryCoolDown(h) {
+					t.Errorf("%+v is not cooling down", h)
+				}
+			}
+		})
+	}
+
+	// removeCoolDown gives the post back.
+	gc := newTestGuildConfigManager(t, guildConfig{coolDown: 5 * time.Second, coolDownScope: "user"}, nil)
+	h := &testHandler{user: "u1", guild: "g1", channel: "c1"}
+	gc.tryCoolDown(h)
+	gc.removeCoolDown(h)
+	if !gc.tryCoolDown(h) {
+		t.Error("the post is still cooling down after removeCoolDown")
+	}
+}
+
+func TestTryCoolDownMessage(t *testing.T) {
+	clock := clocktest.NewClock(time.Unix(0, 0))
+	// The config validation and the config command make sure that the message is never empty.
+	gc := newTestGuildConfigManager(t, guildConfig{coolDown: 5 * time.Second, coolDownMessage: "Cooling down, {remaining} left.", coolDownScope: "channel"}, map[string]guildConfig{
+		"g2": {coolDown: 5 * time.Second, coolDownMessage: "Wait {remaining}!", coolDownScope: "channel"},
+	})
+	gc.cdCounter = utils.NewCoolDownCounterWithClock(clock)
+
+	tests := []struct {
+		guildID, want string
+	}{
+		{"g1", "Cooling down, 4s left."},
+		{"g2", "Wait 4s!"},
+	}
+	for _, tc := range tests {
+		gc.tryCoolDown(&testHandler{user: "u1", guild: tc.guildID, channel: "c-" + tc.guildID})
+	}
+	clock.Advance(1500 * time.Millisecond)
+	for _, tc := range tests {
+		h := &testHandler{user: "u1", guild: tc.guildID, channel: "c-" + tc.guildID}
+		if gc.tryCoolDown(h) || len(h.replies) != 1 || h.replies[0] != tc.want {
+			t.Errorf("the cooldown in %s replied %q, want %q", tc.guildID, h.replies, tc.want)
+		}
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	gc := newTestGuildConfigManager(t,
+		guildConfig{permissions: map[string]permissionRule{
+			"add":    {Roles: []string{"editor"}},
+			"rename": {Users: []string{"u2"}},
+		}},
+		map[string]guildConfig{"g2": {permissions: map[string]permissionRule{
+			"add": {Roles: []string{"artist"}},
+		}}},
+		"owner",
+	)
+
+	tests := []struct {
+		h       *testHandler
+		command string
+		want    bool
+	}{
+		{&testHandler{user: "u1", guild: "g1"}, "post", true},
+		{&testHandler{user: "u1", guild: "g1"}, "add", false},
+		{&testHandler{user: "u1", guild: "g1", roles: []string{"editor"}}, "add", true},
+		{&testHandler{user: "u2", guild: "g1"}, "rename", true},
+		{&testHandler{user: "u1", guild: "g1", roles: []string{"editor"}}, "rename", false},
+		// The guild rule takes precedence over the default one.
+		{&testHandler{user: "u1", guild: "g2", roles: []string{"editor"}}, "add", false},
+		{&testHandler{user: "u1", guild: "g2", roles: []string{"artist"}}, "add", true},
+		{&testHandler{user: "u2", guild: "g2"}, "rename", true},
+		{&testHandler{user: "owner", guild: "g2"}, "add", true},
+		{&testHandler{user: "u1"}, "add", false},
+	}
+	for _, tc := range tests {
+		if got := gc.hasPermission(tc.h, tc.command); got != tc.want {
+			t.Errorf("hasPermission(%+v, %q) = %v, want %v", tc.h, tc.command, got, tc.want)
+		}
+	}
+}
+
+func TestPostableStickers(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "stickers")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alpha.txt", "bravo.txt", "charlie.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metadata := sticker.MetadataPath(filepath.Join(dir, "stickers.json"))
+	sm, err := sticker.NewManager(root, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetNSFW(sm.MatchedStickers([][]string{{"bravo"}})[0], true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flag is kept across restarts.
+	sm, err = sticker.NewManager(root, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(ss []*sticker.Sticker) []string {
+		var ret []string
+		for _, s := range ss {
+			ret = append(ret, s.Name())
+		}
+		return ret
+	}
+	if got, want := names(postableStickers(&testHandler{}, sm.Stickers())), []string{"alpha", "charlie"}; !slices.Equal(got, want) {
+		t.Errorf("postableStickers() outside age-restricted channels = %v, want %v", got, want)
+	}
+	if got, want := names(postableStickers(&testHandler{nsfw: true}, sm.Stickers())), []string{"alpha", "bravo", "charlie"}; !slices.Equal(got, want) {
+		t.Errorf("postableStickers() in an age-restricted channel = %v, want %v", got, want)
+	}
+}
+
+func TestCheckCommandChannels(t *testing.T) {
+	gc := newTestGuildConfigManager(t, guildConfig{}, map[string]guildConfig{
+		"g1": {
+			channels:        channelRule{Deny: []string{"c2"}},
+			commandChannels: map[string]channelRule{"post": {Allow: []string{"c3"}}},
+		},
+	})
+
+	tests := []struct {
+		h       *testHandler
+		command string
+		want    bool
+	}{
+		{&testHandler{guild: "g1", channel: "c1"}, "list", true},
+		{&testHandler{guild: "g1", channel: "c2"}, "list", false},
+		// The rule of the command replaces the one of the guild.
+		{&testHandler{guild: "g1", channel: "c3"}, "post", true},
+		{&testHandler{guild: "g1", channel: "c1"}, "post", false},
+		{&testHandler{guild: "g2", channel: "c2"}, "list", true},
+		{&testHandler{channel: "dm"}, "post", true},
+	}
+	for _, tc := range tests {
+		tc.h.user = "u1"
+		if got := gc.checkCommand(tc.h, tc.command); got != tc.want {
+			t.Errorf("checkCommand() of %q in %s of %q = %v, want %v", tc.command, tc.h.channel, tc.h.guild, got, tc.want)
+		}
+		if informed := len(tc.h.replies) != 0; informed == tc.want {
+			t.Errorf("checkCommand() of %q in %s of %q replied %q, want a reply only on denial", tc.command, tc.h.channel, tc.h.guild, tc.h.replies)
+		}
+	}
+}
+
+func TestMatchPrefix(t *testing.T) {
+	gc := newTestGuildConfigManager(t, guildConfig{prefixes: []string{"!!"}}, map[string]guildConfig{
+		"g1": {prefixes: []string{"?", "??"}},
+	})
+
+	tests := []struct {
+		guild, content string
+		want           string
+		ok             bool
+	}{
+		{"", "!!/help", "!!", true},
+		{"g2", "!!miko", "!!", true},
+		{"g1", "!!miko", "", false},
+		// The longest prefix wins.
+		{"g1", "??miko", "??", true},
+		{"g1", "?miko", "?", true},
+		{"g1", "miko", "", false},
+	}
+	for _, tc := range tests {
+		if got, ok := gc.matchPrefix(tc.guild, tc.content); got != tc.want || ok != tc.ok {
+			t.Errorf("matchPrefix(%q, %q) = %q, %v; want %q, %v", tc.guild, tc.content, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+// newTestLibrary creates a manager on a temporary library with a PNG sticker for each name,
+// and a tracker recording the posts without persisting the recent history.
+func newTestLibrary(t *testing.T, names ...string) (*sticker.Manager, *usageTracker) {
+	t.Helper()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "stickers")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		f, err := os.Create(filepath.Join(root, name+".png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sm, err := sticker.NewManager(root, sticker.MetadataPath(filepath.Join(dir, "stickers.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder, err := stats.Open(filepath.Join(dir, "stats.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close() })
+	recent, err := userdata.NewRecent(10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sm, &usageTracker{stats: recorder, recent: recent}
+}
+
+func TestHandleRandomWithoutPatterns(t *testing.T) {
+	sm, ut := newTestLibrary(t, "alpha", "bravo")
+
+	h := &testHandler{user: "u1", guild: "g1", channel: "c1"}
+	handleRandom(h, sm, ut, "", "")
+	if want := []string{"posted .png"}; !slices.Equal(h.replies, want) {
+		t.Fatalf("random replied %q, want %q", h.replies, want)
+	}
+	if got := ut.recent.List("u1"); len(got) != 1 {
+		t.Errorf("the recent history has %v, want the posted sticker", got)
+	}
+}
+
+func TestHandleTopHidesNSFW(t *testing.T) {
+	sm, ut := newTestLibrary(t, "alpha", "bravo")
+	for _, s := range sm.Stickers() {
+		ut.posted(&testHandler{user: "u1", guild: "g1", channel: "c1"}, s)
+	}
+	if err := sm.SetNSFW(sm.MatchedStickers([][]string{{"bravo"}})[0], true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		nsfw          bool
+		shown, hidden string
+	}{
+		{false, hiddenNSFWName, "bravo"},
+		{true, "bravo", hiddenNSFWName},
+	}
+	for _, tc := range tests {
+		h := &testHandler{user: "u1", guild: "g1", channel: "c1", nsfw: tc.nsfw}
+		handleTop(h, sm, ut, 10, false, 0)
+		got := strings.Join(h.replies, "\n")
+		if !strings.Contains(got, "alpha") || !strings.Contains(got, tc.shown) || strings.Contains(got, tc.hidden) {
+			t.Errorf("top in a channel with nsfw=%v replied %q, want alpha and %s without %s", tc.nsfw, got, tc.shown, tc.hidden)
+		}
+	}
+}
+
+func TestHandleComboRecorded(t *testing.T) {
+	sm, ut := newTestLibrary(t, "alpha", "bravo")
+
+	h := &testHandler{user: "u1", guild: "g1", channel: "c1"}
+	handleCombo(h, sm, ut, []string{"alpha", "bravo"}, false)
+	if want := []string{"posted .png"}; !slices.Equal(h.replies, want) {
+		t.Fatalf("combo replied %q, want %q", h.replies, want)
+	}
+
+	us, err := ut.stats.Usages(stats.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 2 || us[0].Sticker != "alpha" || us[1].Sticker != "bravo" {
+		t.Errorf("the recorded usages are %+v, want one post of alpha and bravo each", us)
+	}
+	if got := ut.recent.List("u1"); len(got) != 2 {
+		t.Errorf("the recent history has %v, want both stickers", got)
+	}
+}
@@ -2,10 +2,14 @@ module discordsticker
 
 go 1.25.0
 
-require github.com/bwmarrin/discordgo v0.28.1
+require (
+	github.com/bwmarrin/discordgo v0.28.1
+	golang.org/x/image v0.45.0
+)
 
 require (
 	github.com/gorilla/websocket v1.5.3 // indirect
 	golang.org/x/crypto v0.54.0 // indirect
 	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.41.0 // indirect
 )
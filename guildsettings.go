@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// guildOverride holds the per-guild settings changed with the config command.
+// Nil fields and empty CommandPrefixes are not overridden.
+type guildOverride struct {
+	CoolDown           *int       `json:",omitempty"`
+	CoolDownMessage    *string    `json:",omitempty"`
+	CoolDownScope      *string    `json:",omitempty"`
+	CoolDownNotice     *string    `json:",omitempty"`
+	RateLimit          *rateLimit `json:",omitempty"`
+	CommandPrefixes    []string   `json:",omitempty"`
+	ModChannelID       *string    `json:",omitempty"`
+	DailyQuotaPerUser  *int       `json:",omitempty"`
+	DailyQuotaPerGuild *int       `json:",omitempty"`
+}
+
+func (o guildOverride) apply(c guildConfig) guildConfig {
+	if o.CoolDown != nil {
+		c.coolDown = time.Duration(*o.CoolDown) * time.Second
+	}
+	if o.CoolDownMessage != nil {
+		c.coolDownMessage = *o.CoolDownMessage
+	}
+	if o.CoolDownScope != nil {
+		c.coolDownScope = *o.CoolDownScope
+	}
+	if o.CoolDownNotice != nil {
+		c.coolDownNotice = *o.CoolDownNotice
+	}
+	if o.RateLimit != nil {
+		c.rateLimit = *o.RateLimit
+	}
+	if len(o.CommandPrefixes) != 0 {
+		c.prefixes = o.CommandPrefixes
+	}
+	if o.ModChannelID != nil {
+		c.modChannelID = *o.ModChannelID
+	}
+	if o.DailyQuotaPerUser != nil {
+		c.dailyQuotaPerUser = *o.DailyQuotaPerUser
+	}
+	if o.DailyQuotaPerGuild != nil {
+		c.dailyQuotaPerGuild = *o.DailyQuotaPerGuild
+	}
+	return c
+}
+
+// guildOverrides keeps the overrides of the guilds, which are merged over PerGuildConfig.
+// Every change is written to the file immediately.
+type guildOverrides struct {
+	mu        sync.Mutex
+	path      string
+	overrides map[string]guildOverride
+}
+
+// openGuildOverrides loads the overrides in path. The file is created on the first change.
+func openGuildOverrides(path string) (*guildOverrides, error) {
+	g := &guildOverrides{path: path, overrides: make(map[string]guildOverride)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &g.overrides); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *guildOverrides) get(guildID string) (guildOverride, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	o, ok := g.overrides[guildID]
+	return o, ok
+}
+
+// update changes the override of the guild with f and saves the file.
+// The override is kept unchanged if f fails or the file cannot be saved.
+// The error of f is returned as is; Saving failure is logged and returned as errSaveOverrides.
+func (g *guildOverrides) update(guildID string, f func(o *guildOverride) error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	old, existed := g.overrides[guildID]
+	o := old
+	if err := f(&o); err != nil {
+		return err
+	}
+	if reflect.ValueOf(o).IsZero() {
+		delete(g.overrides, guildID)
+	} else {
+		g.overrides[guildID] = o
+	}
+	if err := g.save(); err != nil {
+		log.Println("Failed to save the guild overrides:", err)
+		if existed {
+			g.overrides[guildID] = old
+		} else {
+			delete(g.overrides, guildID)
+		}
+		return errSaveOverrides
+	}
+	return nil
+}
+
+var errSaveOverrides = errors.New("failed to save the guild overrides")
+
+func (g *guildOverrides) save() error {
+	b, err := json.MarshalIndent(g.overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := g.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, g.path)
+}
+
+// guildSetting is a setting which can be changed at runtime with the config command.
+type guildSetting struct {
+	desc string
+	// set parses value and stores it in o. The error is shown to the user.
+	set   func(o *guildOverride, value string) error
+	reset func(o *guildOverride)
+	// show formats the effective value.
+	show func(c guildConfig) string
+	// overridden reports whether o overrides the setting.
+	overridden func(o guildOverride) bool
+}
+
+func parseNonNegative(key, value string) (*int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("`%s` expects a non-negative integer, got `%s`.", key, value)
+	}
+	return &v, nil
+}
+
+// guildSettingKeys are the keys of guildSettings in order.
+var guildSettingKeys = []string{"cooldown", "cooldown-message", "cooldown-scope", "cooldown-notice", "rate-limit", "prefix", "mod-channel", "quota-user", "quota-guild"}
+
+var guildSettings = map[string]guildSetting{
+	"cooldown": {
+		desc: "The cooldown of posting in seconds. 0 disables the cooldown.",
+		set: func(o *guildOverride, value string) (err error) {
+			o.CoolDown, err = parseNonNegative("cooldown", value)
+			return err
+		},
+		reset:      func(o *guildOverride) { o.CoolDown = nil },
+		show:       func(c guildConfig) string { return c.coolDown.String() },
+		overridden: func(o guildOverride) bool { return o.CoolDown != nil },
+	},
+	"cooldown-message": {
+		desc: "The reply when posting is cooling down. `{remaining}` is replaced with the time left.",
+		set: func(o *guildOverride, value string) error {
+			if value == "" {
+				return errors.New("`cooldown-message` must not be empty.")
+			}
+			o.CoolDownMessage = &value
+			return nil
+		},
+		reset:      func(o *guildOverride) { o.CoolDownMessage = nil },
+		show:       func(c guildConfig) string { return strconv.Quote(c.coolDownMessage) },
+		overridden: func(o guildOverride) bool { return o.CoolDownMessage != nil },
+	},
+	"cooldown-scope": {
+		desc: "What a cooldown blocks: `" + strings.Join(coolDownScopes, "`, `") + "`.",
+		set: func(o *guildOverride, value string) error {
+			if !slices.Contains(coolDownScopes, value) {
+				return fmt.Errorf("`cooldown-scope` expects one of `%s`, got `%s`.", strings.Join(coolDownScopes, "`, `"), value)
+			}
+			o.CoolDownScope = &value
+			return nil
+		},
+		reset:      func(o *guildOverride) { o.CoolDownScope = nil },
+		show:       func(c guildConfig) string { return "`" + c.coolDownScope + "`" },
+		overridden: func(o guildOverride) bool { return o.CoolDownScope != nil },
+	},
+	"cooldown-notice": {
+		desc: "How the cooldown message is sent: `" + strings.Join(coolDownNotices, "`, `") + "`.",
+		set: func(o *guildOverride, value string) error {
+			if !slices.Contains(coolDownNotices, value) {
+				return fmt.Errorf("`cooldown-notice` expects one of `%s`, got `%s`.", strings.Join(coolDownNotices, "`, `"), value)
+			}
+			o.CoolDownNotice = &value
+			return nil
+		},
+		reset:      func(o *guildOverride) { o.CoolDownNotice = nil },
+		show:       func(c guildConfig) string { return "`" + c.coolDownNotice + "`" },
+		overridden: func(o guildOverride) bool { return o.CoolDownNotice != nil },
+	},
+	"rate-limit": {
+		desc: "`<posts>/<seconds> [<burst>]` to allow the posts in the seconds instead of the cooldown, e.g. `3/10`, or `off`.",
+		set: func(o *guildOverride, value string) error {
+			if value == "off" {
+				o.RateLimit = &rateLimit{}
+				return nil
+			}
+			var r rateLimit
+			invalid := fmt.Errorf("`rate-limit` expects `<posts>/<seconds> [<burst>]` or `off`, got `%s`.", value)
+			limit, burst, hasBurst := strings.Cut(value, " ")
+			rate, period, ok := strings.Cut(limit, "/")
+			if !ok {
+				return invalid
+			}
+			var err error
+			if r.Rate, err = strconv.Atoi(rate); err != nil || r.Rate <= 0 {
+				return invalid
+			}
+			if r.Period, err = strconv.Atoi(strings.TrimSuffix(period, "s")); err != nil || r.Period <= 0 {
+				return invalid
+			}
+			if hasBurst {
+				if r.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || r.Burst <= 0 {
+					return invalid
+				}
+			}
+			o.RateLimit = &r
+			return nil
+		},
+		reset:      func(o *guildOverride) { o.RateLimit = nil },
+		show:       func(c guildConfig) string { return "`" + c.rateLimit.String() + "`" },
+		overridden: func(o guildOverride) bool { return o.RateLimit != nil },
+	},
+	"prefix": {
+		desc: "The prefixes of the text commands separated by spaces. The first one is shown in the help.",
+		set: func(o *guildOverride, value string) error {
+			prefixes := strings.Fields(value)
+			if len(prefixes) == 0 {
+				return errors.New("`prefix` expects at least one prefix.")
+			}
+			for _, p := range prefixes {
+				if err := checkPrefix(p); err != nil {
+					return fmt.Errorf("Prefix `%s` %v.", p, err)
+				}
+			}
+			o.CommandPrefixes = prefixes
+			return nil
+		},
+		reset:      func(o *guildOverride) { o.CommandPrefixes = nil },
+		show:       func(c guildConfig) string { return "`" + strings.Join(c.prefixes, "` `") + "`" },
+		overridden: func(o guildOverride) bool { return len(o.CommandPrefixes) != 0 },
+	},
+	"mod-channel": {
+		desc: "The channel to review the new stickers in, or `none` to disable the approval queue.",
+		set: func(o *guildOverride, value string) error {
+			id := strings.TrimSuffix(strings.TrimPrefix(value, "<#"), ">")
+			if value == "none" {
+				id = ""
+			} else if !isSnowflake(id) {
+				return fmt.Errorf("`mod-channel` expects a channel or `none`, got `%s`.", value)
+			}
+			o.ModChannelID = &id
+			return nil
+		},
+		reset: func(o *guildOverride) { o.ModChannelID = nil },
+		show: func(c guildConfig) string {
+			if c.modChannelID == "" {
+				return "none"
+			}
+			return "<#" + c.modChannelID + ">"
+		},
+		overridden: func(o guildOverride) bool { return o.ModChannelID != nil },
+	},
+	"quota-user": {
+		desc: "The number of changes a user can make in a day. 0 means no limit.",
+		set: func(o *guildOverride, value string) (err error) {
+			o.DailyQuotaPerUser, err = parseNonNegative("quota-user", value)
+			return err
+		},
+		reset:      func(o *guildOverride) { o.DailyQuotaPerUser = nil },
+		show:       func(c guildConfig) string { return strconv.Itoa(c.dailyQuotaPerUser) },
+		overridden: func(o guildOverride) bool { return o.DailyQuotaPerUser != nil },
+	},
+	"quota-guild": {
+		desc: "The number of changes the guild can make in a day. 0 means no limit.",
+		set: func(o *guildOverride, value string) (err error) {
+			o.DailyQuotaPerGuild, err = parseNonNegative("quota-guild", value)
+			return err
+		},
+		reset:      func(o *guildOverride) { o.DailyQuotaPerGuild = nil },
+		show:       func(c guildConfig) string { return strconv.Itoa(c.dailyQuotaPerGuild) },
+		overridden: func(o guildOverride) bool { return o.DailyQuotaPerGuild != nil },
+	},
+}
+
+// effectiveConf returns the config in effect in the guild, with the default prefixes filled in.
+func (gc *guildConfigManager) effectiveConf(guildID string) guildConfig {
+	c, _ := gc.guildConf(guildID)
+	c.prefixes = gc.prefixes(guildID)
+	return c
+}
+
+// handleConfigGet shows the effective settings of the guild of h, marking the ones changed with the config command.
+func handleConfigGet(h handler, gc *guildConfigManager) {
+	if h.guildID() == "" {
+		h.replyPrivate("The settings can only be viewed in a guild.")
+		return
+	}
+	c := gc.effectiveConf(h.guildID())
+	o, _ := gc.overrides.get(h.guildID())
+	sb := strings.Builder{}
+	sb.WriteString("Settings of this guild:\n")
+	for _, key := range guildSettingKeys {
+		st := guildSettings[key]
+		fmt.Fprintf(&sb, "`%s` = %s", key, st.show(c))
+		if st.overridden(o) {
+			sb.WriteString(" (changed)")
+		}
+		sb.WriteString("\n")
+	}
+	h.replyPrivate(sb.String())
+}
+
+// handleConfigSet changes the setting of the guild of h to value.
+// With reset, the change made by the config command is dropped, which restores the value in the config file.
+func handleConfigSet(h handler, gc *guildConfigManager, key, value string, reset bool) {
+	if h.guildID() == "" {
+		h.replyPrivate("The settings can only be changed in a guild.")
+		return
+	}
+	st, ok := guildSettings[key]
+	if !ok {
+		sb := strings.Builder{}
+		fmt.Fprintf(&sb, "Unknown setting `%s`. The settings are:\n", key)
+		for _, k := range guildSettingKeys {
+			fmt.Fprintf(&sb, "`%s`: %s\n", k, guildSettings[k].desc)
+		}
+		h.replyPrivate(sb.String())
+		return
+	}
+	if err := gc.overrides.update(h.guildID(), func(o *guildOverride) error {
+		if reset {
+			st.reset(o)
+		} else if err := st.set(o, value); err != nil {
+			return err
+		}
+		if c := o.apply(gc.baseConf(h.guildID())); (c.coolDown > 0 || c.rateLimit.enabled()) && c.coolDownMessage == "" {
+			return errors.New("The cooldown and the rate limit need a message. Set `cooldown-message` first.")
+		}
+		return nil
+	}); err != nil {
+		if err != errSaveOverrides {
+			h.replyPrivate(err.Error())
+		} else {
+			h.replyPrivate("Something goes wrong here! Please contact the admin.")
+		}
+		return
+	}
+
+	c := gc.effectiveConf(h.guildID())
+	if reset {
+		log.Printf("%s `config reset` %s in guild %s", h.userInfo(), key, h.guildID())
+	} else {
+		log.Printf("%s `config set` %s=%q in guild %s", h.userInfo(), key, value, h.guildID())
+	}
+	h.replyPublic(fmt.Sprintf("Done. `%s` is %s now.", key, st.show(c)))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"discordsticker/utils"
+)
+
+func TestGuildSettingsSet(t *testing.T) {
+	tests := []struct {
+		key, value string
+		// want is the shown value after setting, or empty if value is invalid.
+		want string
+	}{
+		{"cooldown", "10", "10s"},
+		{"cooldown", "0", "0s"},
+		{"cooldown", "-1", ""},
+		{"cooldown", "ten", ""},
+		{"cooldown-message", "Wait {remaining}", `"Wait {remaining}"`},
+		{"cooldown-message", "", ""},
+		{"cooldown-scope", "user+channel", "`user+channel`"},
+		{"cooldown-scope", "world", ""},
+		{"cooldown-notice", "ephemeral", "`ephemeral`"},
+		{"cooldown-notice", "loud", ""},
+		{"rate-limit", "3/10", "`3/10s burst 3`"},
+		{"rate-limit", "3/10s 5", "`3/10s burst 5`"},
+		{"rate-limit", "off", "`off`"},
+		{"rate-limit", "3", ""},
+		{"rate-limit", "0/10", ""},
+		{"rate-limit", "3/0", ""},
+		{"rate-limit", "3/10 0", ""},
+		{"rate-limit", "3/10 x", ""},
+		{"prefix", "!! ??", "`!!` `??`"},
+		{"prefix", "  ", ""},
+		{"prefix", "!! /x", ""},
+		{"mod-channel", "<#123456789012345678>", "<#123456789012345678>"},
+		{"mod-channel", "123456789012345678", "<#123456789012345678>"},
+		{"mod-channel", "none", "none"},
+		{"mod-channel", "#mods", ""},
+		{"quota-user", "5", "5"},
+		{"quota-user", "-5", ""},
+		{"quota-guild", "0", "0"},
+		{"quota-guild", "1.5", ""},
+	}
+	base := guildConfig{rateLimit: rateLimit{Rate: 1, Period: 1}, modChannelID: "1"}
+	for _, tc := range tests {
+		st := guildSettings[tc.key]
+		var o guildOverride
+		err := st.set(&o, tc.value)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("setting %s to %q succeeded, want an error", tc.key, tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("setting %s to %q failed: %v", tc.key, tc.value, err)
+			continue
+		}
+		if !st.overridden(o) {
+			t.Errorf("setting %s to %q is not recorded as overridden", tc.key, tc.value)
+		}
+		if got := st.show(o.apply(base)); got != tc.want {
+			t.Errorf("setting %s to %q shows %s, want %s", tc.key, tc.value, got, tc.want)
+		}
+		if st.reset(&o); st.overridden(o) {
+			t.Errorf("%s is still overridden after resetting", tc.key)
+		}
+	}
+}
+
+func TestHandleConfigSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guild_config.json")
+	overrides, err := openGuildOverrides(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultConfig := guildConfig{coolDown: 5 * time.Second, coolDownMessage: "Cooling down...", prefixes: []string{"!!"}}
+	perGuildConfig := map[string]guildConfig{
+		// g2 has no cooldown, so it has no cooldown message.
+		"g2": {prefixes: []string{"??"}},
+	}
+	gc := newGuildConfigManager(defaultConfig, perGuildConfig, overrides, nil, utils.NewCoolDownCounter(), utils.NewRateLimiter(utils.RealClock{}))
+
+	set := func(guildID, key, value string, reset bool) string {
+		h := &testHandler{user: "u1", guild: guildID}
+		handleConfigSet(h, gc, key, value, reset)
+		return strings.Join(h.replies, "\n")
+	}
+
+	if got, want := set("g1", "cooldown", "10", false), "Done. `cooldown` is 10s now."; got != want {
+		t.Errorf("setting cooldown replied %q, want %q", got, want)
+	}
+	if c, _ := gc.guildConf("g1"); c.coolDown != 10*time.Second || c.coolDownMessage != "Cooling down..." {
+		t.Errorf("the guild config is %+v, want the cooldown of 10s with the default message", c)
+	}
+	if got := set("g1", "volume", "11", false); !strings.HasPrefix(got, "Unknown setting `volume`.") {
+		t.Errorf("setting an unknown key replied %q", got)
+	}
+	if got := set("", "cooldown", "10", false); got != "The settings can only be changed in a guild." {
+		t.Errorf("setting in DM replied %q", got)
+	}
+
+	// The cooldown and the rate limit cannot be enabled without a message.
+	for _, kv := range [][2]string{{"cooldown", "3"}, {"rate-limit", "1/5"}} {
+		if got := set("g2", kv[0], kv[1], false); !strings.Contains(got, "Set `cooldown-message` first.") {
+			t.Errorf("setting %s without a message replied %q", kv[0], got)
+		}
+	}
+	set("g2", "cooldown-message", "Wait", false)
+	set("g2", "cooldown", "3", false)
+	if got := set("g2", "cooldown-message", "", true); !strings.Contains(got, "Set `cooldown-message` first.") {
+		t.Errorf("resetting the message of an enabled cooldown replied %q", got)
+	}
+	if c, _ := gc.guildConf("g2"); c.coolDown != 3*time.Second || c.coolDownMessage != "Wait" || c.prefixes[0] != "??" {
+		t.Errorf("the guild config is %+v, want the cooldown of 3s with the message set and the prefixes of the config", c)
+	}
+
+	// The overrides survive restarts, and resetting all settings removes the guild.
+	reloaded, err := openGuildOverrides(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := reloaded.get("g1"); !ok || o.CoolDown == nil || *o.CoolDown != 10 {
+		t.Errorf("the reloaded override of g1 is %+v, want the cooldown of 10", o)
+	}
+	set("g1", "cooldown", "", true)
+	if _, ok := gc.overrides.get("g1"); ok {
+		t.Error("g1 still has overrides after resetting all of them")
+	}
+	if _, ok := gc.guildConf("g1"); ok {
+		t.Error("g1 still has its own config after resetting all of the overrides")
+	}
+}
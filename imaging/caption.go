@@ -0,0 +1,156 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+type CaptionPosition int
+
+const (
+	CaptionBottom CaptionPosition = iota
+	CaptionTop
+)
+
+const (
+	// The caption is shrunk until it fits in the width and captionMaxHeightRatio of the height.
+	captionMaxHeightRatio = 1.0 / 3
+	captionMaxFontSize    = 72
+	captionMinFontSize    = 8
+	captionMargin         = 0.04
+)
+
+var (
+	captionFontOnce sync.Once
+	captionFont     *opentype.Font
+	captionFontErr  error
+)
+
+func loadCaptionFont() (*opentype.Font, error) {
+	captionFontOnce.Do(func() {
+		captionFont, captionFontErr = opentype.Parse(gobold.TTF)
+	})
+	return captionFont, captionFontErr
+}
+
+// wrapText breaks text into lines no wider than width.
+// A single word wider than width is put on its own line.
+func wrapText(face font.Face, text string, width fixed.Int26_6) []string {
+	var lines []string
+	line := ""
+	for _, w := range strings.Fields(text) {
+		if line == "" {
+			line = w
+			continue
+		}
+		if font.MeasureString(face, line+" "+w) <= width {
+			line += " " + w
+			continue
+		}
+		lines = append(lines, line)
+		line = w
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// captionMasks renders text for a w*h image.
+// It returns the glyph mask, the outline mask, and where the masks should be drawn.
+func captionMasks(text string, pos CaptionPosition, w, h int) (*image.Alpha, *image.Alpha, image.Point, error) {
+	f, err := loadCaptionFont()
+	if err != nil {
+		return nil, nil, image.Point{}, err
+	}
+
+	margin := int(float64(min(w, h)) * captionMargin)
+	maxWidth := fixed.I(w - 2*margin)
+	maxHeight := int(float64(h) * captionMaxHeightRatio)
+
+	// Find the largest font size that fits.
+	var (
+		face  font.Face
+		lines []string
+		size  float64
+	)
+	for size = min(captionMaxFontSize, float64(h)/4); ; size-- {
+		if face != nil {
+			face.Close()
+		}
+		face, err = opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, nil, image.Point{}, err
+		}
+		lines = wrapText(face, text, maxWidth)
+		fits := len(lines)*face.Metrics().Height.Ceil() <= maxHeight
+		for _, l := range lines {
+			fits = fits && font.MeasureString(face, l) <= maxWidth
+		}
+		if fits || size <= captionMinFontSize {
+			break
+		}
+	}
+	defer face.Close()
+
+	stroke := max(1, int(size/16))
+	lineHeight := face.Metrics().Height.Ceil()
+	ascent := face.Metrics().Ascent.Ceil()
+	mw := w
+	mh := len(lines)*lineHeight + 2*stroke
+	glyph := image.NewAlpha(image.Rect(0, 0, mw, mh))
+	d := &font.Drawer{Dst: glyph, Src: image.Opaque, Face: face}
+	for i, l := range lines {
+		d.Dot = fixed.P((mw-font.MeasureString(face, l).Ceil())/2, stroke+i*lineHeight+ascent)
+		d.DrawString(l)
+	}
+
+	// Dilate the glyphs to get the outline.
+	outline := image.NewAlpha(glyph.Rect)
+	for y := 0; y < mh; y++ {
+		for x := 0; x < mw; x++ {
+			var a uint8
+			for dy := -stroke; dy <= stroke && a < 0xff; dy++ {
+				for dx := -stroke; dx <= stroke; dx++ {
+					if dx*dx+dy*dy > stroke*stroke {
+						continue
+					}
+					if p := image.Pt(x+dx, y+dy); p.In(glyph.Rect) {
+						a = max(a, glyph.AlphaAt(p.X, p.Y).A)
+					}
+				}
+			}
+			outline.SetAlpha(x, y, color.Alpha{A: a})
+		}
+	}
+
+	at := image.Pt(0, margin)
+	if pos == CaptionBottom {
+		at.Y = h - margin - mh
+	}
+	return glyph, outline, at, nil
+}
+
+// DrawCaption draws text with white letters and black outlines on every frame.
+// The font size is chosen automatically to fit the image.
+func (img *Image) DrawCaption(text string, pos CaptionPosition) error {
+	b := img.Frames[0].Bounds()
+	glyph, outline, at, err := captionMasks(text, pos, b.Dx(), b.Dy())
+	if err != nil {
+		return err
+	}
+	r := glyph.Rect.Add(at)
+	for _, f := range img.Frames {
+		draw.DrawMask(f, r, image.Black, image.Point{}, outline, image.Point{}, draw.Over)
+		draw.DrawMask(f, r, image.White, image.Point{}, glyph, image.Point{}, draw.Over)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package imaging
+
+import (
+	"image"
+	"testing"
+)
+
+// drawnRows returns the range of the rows with opaque pixels.
+func drawnRows(img *image.NRGBA) (first, last int) {
+	first, last = -1, -1
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.NRGBAAt(x, y).A != 0 {
+				if first < 0 {
+					first = y
+				}
+				last = y
+				break
+			}
+		}
+	}
+	return first, last
+}
+
+func TestDrawCaption(t *testing.T) {
+	const w, h = 160, 120
+	for _, tc := range []struct {
+		name string
+		pos  CaptionPosition
+		// The caption must be drawn within the rows [from, to).
+		from, to int
+	}{
+		{"top", CaptionTop, 0, h / 3},
+		{"bottom", CaptionBottom, h - h/3, h},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			img := &Image{Frames: []*image.NRGBA{
+				image.NewNRGBA(image.Rect(0, 0, w, h)),
+				image.NewNRGBA(image.Rect(0, 0, w, h)),
+			}}
+			if err := img.DrawCaption("hello world", tc.pos); err != nil {
+				t.Fatal(err)
+			}
+			for i, f := range img.Frames {
+				first, last := drawnRows(f)
+				if first < tc.from || last >= tc.to {
+					t.Errorf("frame %d: the caption is drawn in the rows [%d, %d], want within [%d, %d)", i, first, last, tc.from, tc.to)
+				}
+			}
+		})
+	}
+}
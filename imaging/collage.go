@@ -0,0 +1,61 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// maxCollageHeight bounds the height of every image in a collage.
+const maxCollageHeight = 512
+
+// Collage puts the first frames of imgs together in rows of at most columns images.
+// All images are resized to the same height, which is the smallest height among them,
+// and the rows are horizontally centered.
+func Collage(imgs []*Image, columns int) (*Image, error) {
+	height := maxCollageHeight
+	for _, img := range imgs {
+		height = min(height, img.Frames[0].Bounds().Dy())
+	}
+
+	var scaled []*image.NRGBA
+	for _, img := range imgs {
+		src := img.Frames[0]
+		b := src.Bounds()
+		width := max(1, b.Dx()*height/b.Dy())
+		dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, b, xdraw.Src, nil)
+		scaled = append(scaled, dst)
+	}
+
+	var rows [][]*image.NRGBA
+	for begin := 0; begin < len(scaled); begin += columns {
+		rows = append(rows, scaled[begin:min(begin+columns, len(scaled))])
+	}
+	rowWidth := func(row []*image.NRGBA) int {
+		w := 0
+		for _, img := range row {
+			w += img.Bounds().Dx()
+		}
+		return w
+	}
+	width := 0
+	for _, row := range rows {
+		width = max(width, rowWidth(row))
+	}
+	if width > MaxScaledSize || height*len(rows) > MaxScaledSize {
+		return nil, ErrTooLarge
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height*len(rows)))
+	for i, row := range rows {
+		x := (width - rowWidth(row)) / 2
+		for _, img := range row {
+			r := img.Bounds().Add(image.Pt(x, i*height))
+			draw.Draw(canvas, r, img, image.Point{}, draw.Src)
+			x += img.Bounds().Dx()
+		}
+	}
+	return &Image{Frames: []*image.NRGBA{canvas}}, nil
+}
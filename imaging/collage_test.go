@@ -0,0 +1,43 @@
+package imaging
+
+import (
+	"image"
+	"testing"
+)
+
+func TestCollage(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns int
+		w, h    int
+	}{
+		// The images are scaled to the height of the smallest one, which is 4.
+		{"row", 3, 8 + 4 + 2, 4},
+		{"grid", 2, 8 + 4, 8},
+	}
+	for _, tc := range tests {
+		imgs := []*Image{newTestImage(16, 8), newTestImage(4, 4), newTestImage(4, 8)}
+		img, err := Collage(imgs, tc.columns)
+		if err != nil {
+			t.Errorf("%s failed: %v", tc.name, err)
+			continue
+		}
+		if len(img.Frames) != 1 || img.Animated {
+			t.Errorf("%s gave %d frames, want one still frame", tc.name, len(img.Frames))
+		}
+		if b := img.Frames[0].Bounds(); b != image.Rect(0, 0, tc.w, tc.h) {
+			t.Errorf("%s is %dx%d, want %dx%d", tc.name, b.Dx(), b.Dy(), tc.w, tc.h)
+		}
+	}
+}
+
+func TestCollageFirstFrames(t *testing.T) {
+	anim := newTestAnimation(10, 10)
+	img, err := Collage([]*Image{anim, anim}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Frames[0].NRGBAAt(1, 0).R; got != 0 {
+		t.Errorf("the collage shows frame %d, want the first frame", got)
+	}
+}
@@ -0,0 +1,165 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/webp"
+)
+
+// MaxPixels limits the total pixels of all frames to bound the memory usage.
+const MaxPixels = 64 << 20
+
+// ErrTooLarge is returned if an image has more than MaxPixels pixels.
+var ErrTooLarge = errors.New("The image is too large to be modified.")
+
+// Image is a decoded sticker.
+// Every frame covers the whole canvas, i.e. animated GIFs are coalesced while decoding,
+// so that the frames can be modified independently.
+// A still image has exactly one frame.
+type Image struct {
+	Frames []*image.NRGBA
+	// Delays are the per-frame delays in 100ths of a second. Only used by animated images.
+	Delays []int
+	// LoopCount follows the semantics of gif.GIF.LoopCount.
+	LoopCount int
+	Animated  bool
+}
+
+var configDecoders = map[string]func(io.Reader) (image.Config, error){
+	".gif":  gif.DecodeConfig,
+	".png":  png.DecodeConfig,
+	".jpg":  jpeg.DecodeConfig,
+	".jpeg": jpeg.DecodeConfig,
+	".webp": webp.DecodeConfig,
+}
+
+// Decode decodes the image in r. ext is the file extension of the sticker, e.g. ".png".
+// ErrTooLarge is returned before decoding if the canvas in the header has more than MaxPixels pixels,
+// since a small compressed file can declare a huge canvas.
+func Decode(r io.Reader, ext string) (*Image, error) {
+	decodeConfig, ok := configDecoders[ext]
+	if !ok {
+		return nil, errors.New("unsupported image type " + ext)
+	}
+	var head bytes.Buffer
+	c, err := decodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, err
+	}
+	if c.Width*c.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	r = io.MultiReader(&head, r)
+
+	switch ext {
+	case ".gif":
+		g, err := gif.DecodeAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return fromGIF(g)
+	case ".png":
+		return decodeStill(png.Decode(r))
+	case ".jpg", ".jpeg":
+		return decodeStill(jpeg.Decode(r))
+	default:
+		return decodeStill(webp.Decode(r))
+	}
+}
+
+func decodeStill(img image.Image, err error) (*Image, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &Image{Frames: []*image.NRGBA{toNRGBA(img)}}, nil
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	ret := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(ret, ret.Bounds(), img, b.Min, draw.Src)
+	return ret
+}
+
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	ret := image.NewNRGBA(img.Rect)
+	copy(ret.Pix, img.Pix)
+	return ret
+}
+
+// fromGIF renders the frames of g onto a canvas one by one with respect to the disposal methods.
+func fromGIF(g *gif.GIF) (*Image, error) {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		// Some encoders do not fill the logical screen size.
+		for _, f := range g.Image {
+			bounds = bounds.Union(f.Bounds())
+		}
+	}
+
+	if bounds.Dx()*bounds.Dy()*len(g.Image) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	ret := &Image{
+		Delays:    make([]int, len(g.Image)),
+		LoopCount: g.LoopCount,
+		Animated:  len(g.Image) > 1,
+	}
+	canvas := image.NewNRGBA(bounds)
+	for i, f := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var prev *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			prev = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, f.Bounds(), f, f.Bounds().Min, draw.Over)
+		ret.Frames = append(ret.Frames, cloneNRGBA(canvas))
+		if i < len(g.Delay) {
+			ret.Delays[i] = g.Delay[i]
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, f.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = prev
+		}
+	}
+	return ret, nil
+}
+
+// Encode writes the image to w and returns the extension of the encoded format.
+// Animated images are encoded as GIF; Still images are encoded as PNG.
+func (img *Image) Encode(w io.Writer) (string, error) {
+	if !img.Animated {
+		return ".png", png.Encode(w, img.Frames[0])
+	}
+
+	b := img.Frames[0].Bounds()
+	g := &gif.GIF{
+		Image:     make([]*image.Paletted, len(img.Frames)),
+		Delay:     img.Delays,
+		Disposal:  make([]byte, len(img.Frames)),
+		LoopCount: img.LoopCount,
+		Config:    image.Config{Width: b.Dx(), Height: b.Dy()},
+	}
+	for i, f := range img.Frames {
+		g.Image[i] = quantize(f)
+		// Every frame covers the whole canvas, so clear it before drawing the next one;
+		// Otherwise the transparent pixels would show the previous frame.
+		g.Disposal[i] = gif.DisposalBackground
+	}
+	return ".gif", gif.EncodeAll(w, g)
+}
@@ -0,0 +1,47 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, newTestImage(3, 2).Frames[0]); err != nil {
+		t.Fatal(err)
+	}
+	img, err := Decode(&buf, ".png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(img.Frames) != 1 || img.Animated || img.Frames[0].Bounds() != image.Rect(0, 0, 3, 2) {
+		t.Errorf("Decode() = %d frames of %v, want one still frame of 3x2", len(img.Frames), img.Frames[0].Bounds())
+	}
+
+	if _, err := Decode(&buf, ".bmp"); err == nil {
+		t.Error("Decode() of an unsupported type succeeded")
+	}
+}
+
+// TestDecodeTooLarge decodes a PNG declaring a huge canvas without the pixel data.
+func TestDecodeTooLarge(t *testing.T) {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], 20000)
+	binary.BigEndian.PutUint32(ihdr[4:], 20000)
+	ihdr[8], ihdr[9] = 8, 6 // 8-bit RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+
+	if _, err := Decode(&buf, ".png"); err != ErrTooLarge {
+		t.Errorf("Decode() = %v, want ErrTooLarge", err)
+	}
+}
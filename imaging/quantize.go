@@ -0,0 +1,159 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// Pixels with alpha lower than transparentThreshold are encoded as transparent in GIFs.
+const transparentThreshold = 0x80
+
+// maxOpaqueColors leaves one palette entry for the transparent color.
+const maxOpaqueColors = 255
+
+// quantize converts img to a paletted image.
+// The exact colors are used if there are not too many of them;
+// Otherwise the palette is built with the median cut algorithm.
+func quantize(img *image.NRGBA) *image.Paletted {
+	hist := make(map[color.NRGBA]int)
+	hasTransparent := false
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			if c.A < transparentThreshold {
+				hasTransparent = true
+				continue
+			}
+			c.A = 0xff
+			hist[c]++
+		}
+	}
+
+	var pal color.Palette
+	if hasTransparent {
+		pal = append(pal, color.NRGBA{})
+	}
+	firstOpaque := len(pal)
+	if len(hist) <= maxOpaqueColors {
+		for c := range hist {
+			pal = append(pal, c)
+		}
+	} else {
+		pal = append(pal, medianCut(hist, maxOpaqueColors)...)
+	}
+	if len(pal) == 0 {
+		// A palette must not be empty.
+		pal = append(pal, color.NRGBA{A: 0xff})
+	}
+
+	ret := image.NewPaletted(b, pal)
+	cache := make(map[color.NRGBA]uint8)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			if c.A < transparentThreshold {
+				// The transparent color is always at index 0.
+				ret.SetColorIndex(x, y, 0)
+				continue
+			}
+			c.A = 0xff
+			idx, ok := cache[c]
+			if !ok {
+				idx = uint8(firstOpaque + pal[firstOpaque:].Index(c))
+				cache[c] = idx
+			}
+			ret.SetColorIndex(x, y, idx)
+		}
+	}
+	return ret
+}
+
+type colorCount struct {
+	c     color.NRGBA
+	count int
+}
+
+type colorBox []colorCount
+
+func channel(c color.NRGBA, ch int) uint8 {
+	switch ch {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	}
+	return c.B
+}
+
+// widest returns the channel with the largest range and the range.
+func (b colorBox) widest() (int, int) {
+	bestCh, bestRange := 0, -1
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := uint8(0xff), uint8(0)
+		for _, cc := range b {
+			v := channel(cc.c, ch)
+			lo = min(lo, v)
+			hi = max(hi, v)
+		}
+		if r := int(hi) - int(lo); r > bestRange {
+			bestCh, bestRange = ch, r
+		}
+	}
+	return bestCh, bestRange
+}
+
+func (b colorBox) average() color.NRGBA {
+	var r, g, bl, total int
+	for _, cc := range b {
+		r += int(cc.c.R) * cc.count
+		g += int(cc.c.G) * cc.count
+		bl += int(cc.c.B) * cc.count
+		total += cc.count
+	}
+	return color.NRGBA{uint8(r / total), uint8(g / total), uint8(bl / total), 0xff}
+}
+
+func medianCut(hist map[color.NRGBA]int, n int) []color.Color {
+	all := make(colorBox, 0, len(hist))
+	for c, count := range hist {
+		all = append(all, colorCount{c, count})
+	}
+	boxes := []colorBox{all}
+	for len(boxes) < n {
+		// Split the box with the widest range.
+		target, targetCh, targetRange := -1, 0, 0
+		for i, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+			if ch, r := b.widest(); r > targetRange {
+				target, targetCh, targetRange = i, ch, r
+			}
+		}
+		if target < 0 {
+			break
+		}
+
+		b := boxes[target]
+		sort.Slice(b, func(i, j int) bool { return channel(b[i].c, targetCh) < channel(b[j].c, targetCh) })
+		total := 0
+		for _, cc := range b {
+			total += cc.count
+		}
+		mid, acc := 1, b[0].count
+		for mid < len(b)-1 && acc*2 < total {
+			acc += b[mid].count
+			mid++
+		}
+		boxes[target] = b[:mid]
+		boxes = append(boxes, b[mid:])
+	}
+
+	ret := make([]color.Color, len(boxes))
+	for i, b := range boxes {
+		ret[i] = b.average()
+	}
+	return ret
+}
@@ -0,0 +1,64 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQuantizeExactColors(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 0xff})
+	img.SetNRGBA(1, 0, color.NRGBA{G: 255, A: 0xff})
+	img.SetNRGBA(2, 0, color.NRGBA{B: 255, A: 0x90})
+	img.SetNRGBA(3, 0, color.NRGBA{R: 255, A: 0x10})
+
+	p := quantize(img)
+	if len(p.Palette) != 4 {
+		t.Errorf("the palette has %d colors, want 4", len(p.Palette))
+	}
+	if p.ColorIndexAt(3, 0) != 0 {
+		t.Error("the translucent pixel is not transparent")
+	}
+	want := []color.NRGBA{{R: 255, A: 0xff}, {G: 255, A: 0xff}, {B: 255, A: 0xff}}
+	for x, c := range want {
+		if got := color.NRGBAModel.Convert(p.At(x, 0)); got != c {
+			t.Errorf("the pixel %d is %v, want %v", x, got, c)
+		}
+	}
+}
+
+func TestQuantizeMedianCut(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 8), G: uint8(y * 8), B: 100, A: 0xff})
+		}
+	}
+
+	p := quantize(img)
+	if len(p.Palette) != maxOpaqueColors {
+		t.Errorf("the palette has %d colors, want %d", len(p.Palette), maxOpaqueColors)
+	}
+	// Every pixel should be close to the original with 1024 colors in 255 boxes.
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			got := color.NRGBAModel.Convert(p.At(x, y)).(color.NRGBA)
+			want := img.NRGBAAt(x, y)
+			if diff(got.R, want.R) > 16 || diff(got.G, want.G) > 16 || got.B != want.B {
+				t.Fatalf("the pixel (%d, %d) is %v, too far from %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestQuantizeTransparent(t *testing.T) {
+	p := quantize(image.NewNRGBA(image.Rect(0, 0, 2, 2)))
+	if len(p.Palette) != 1 || p.ColorIndexAt(0, 0) != 0 {
+		t.Errorf("a transparent image is quantized to the palette %v", p.Palette)
+	}
+}
+
+func diff(a, b uint8) int {
+	return max(int(a)-int(b), int(b)-int(a))
+}
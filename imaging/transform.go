@@ -0,0 +1,220 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+
+	"golang.org/x/image/draw"
+)
+
+// MaxScaledSize is the maximum width and height of a scaled image.
+const MaxScaledSize = 2048
+
+// Transform modifies an image in place.
+type Transform func(img *Image) error
+
+// Apply runs the transforms on img in order.
+func (img *Image) Apply(ts ...Transform) error {
+	for _, t := range ts {
+		if err := t(img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mapFrames(img *Image, f func(*image.NRGBA) *image.NRGBA) {
+	for i, fr := range img.Frames {
+		img.Frames[i] = f(fr)
+	}
+}
+
+// Mirror flips the image horizontally.
+func Mirror() Transform {
+	return func(img *Image) error {
+		mapFrames(img, func(src *image.NRGBA) *image.NRGBA {
+			b := src.Bounds()
+			dst := image.NewNRGBA(b)
+			for y := 0; y < b.Dy(); y++ {
+				for x := 0; x < b.Dx(); x++ {
+					dst.SetNRGBA(b.Dx()-1-x, y, src.NRGBAAt(x, y))
+				}
+			}
+			return dst
+		})
+		return nil
+	}
+}
+
+// Flip flips the image vertically.
+func Flip() Transform {
+	return func(img *Image) error {
+		mapFrames(img, func(src *image.NRGBA) *image.NRGBA {
+			b := src.Bounds()
+			dst := image.NewNRGBA(b)
+			for y := 0; y < b.Dy(); y++ {
+				copy(dst.Pix[(b.Dy()-1-y)*dst.Stride:], src.Pix[y*src.Stride:y*src.Stride+b.Dx()*4])
+			}
+			return dst
+		})
+		return nil
+	}
+}
+
+// Rotate rotates the image clockwise. degree must be a multiple of 90.
+func Rotate(degree int) Transform {
+	degree = ((degree % 360) + 360) % 360
+	return func(img *Image) error {
+		if degree%90 != 0 {
+			return errors.New("Rotation degree must be a multiple of 90.")
+		}
+		if degree == 0 {
+			return nil
+		}
+		mapFrames(img, func(src *image.NRGBA) *image.NRGBA {
+			w, h := src.Bounds().Dx(), src.Bounds().Dy()
+			var dst *image.NRGBA
+			if degree == 180 {
+				dst = image.NewNRGBA(image.Rect(0, 0, w, h))
+			} else {
+				dst = image.NewNRGBA(image.Rect(0, 0, h, w))
+			}
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					c := src.NRGBAAt(x, y)
+					switch degree {
+					case 90:
+						dst.SetNRGBA(h-1-y, x, c)
+					case 180:
+						dst.SetNRGBA(w-1-x, h-1-y, c)
+					case 270:
+						dst.SetNRGBA(y, w-1-x, c)
+					}
+				}
+			}
+			return dst
+		})
+		return nil
+	}
+}
+
+// Grayscale removes the colors of the image while keeping the transparency.
+func Grayscale() Transform {
+	return func(img *Image) error {
+		for _, f := range img.Frames {
+			for i := 0; i < len(f.Pix); i += 4 {
+				g := color.GrayModel.Convert(color.NRGBA{f.Pix[i], f.Pix[i+1], f.Pix[i+2], 0xff}).(color.Gray)
+				f.Pix[i], f.Pix[i+1], f.Pix[i+2] = g.Y, g.Y, g.Y
+			}
+		}
+		return nil
+	}
+}
+
+// Scale resizes the image by factor.
+func Scale(factor float64) Transform {
+	return func(img *Image) error {
+		b := img.Frames[0].Bounds()
+		w, h := int(float64(b.Dx())*factor), int(float64(b.Dy())*factor)
+		if w < 1 || h < 1 {
+			return errors.New("Scaled image is too small.")
+		}
+		if w > MaxScaledSize || h > MaxScaledSize {
+			return fmt.Errorf("Scaled image is too large. Expect at most %dx%d, got %dx%d.", MaxScaledSize, MaxScaledSize, w, h)
+		}
+		if w*h*len(img.Frames) > MaxPixels {
+			return ErrTooLarge
+		}
+		mapFrames(img, func(src *image.NRGBA) *image.NRGBA {
+			dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+			draw.BiLinear.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+			return dst
+		})
+		return nil
+	}
+}
+
+// minGIFDelay is the minimum delay honored by most GIF decoders.
+// Browsers treat shorter delays as defaultGIFDelay.
+const (
+	minGIFDelay     = 2
+	defaultGIFDelay = 10
+)
+
+func requireAnimated(img *Image, name string) error {
+	if !img.Animated {
+		return fmt.Errorf("`%s` is only supported by animated GIFs.", name)
+	}
+	return nil
+}
+
+// Reverse plays the animation backwards.
+func Reverse() Transform {
+	return func(img *Image) error {
+		if err := requireAnimated(img, "reverse"); err != nil {
+			return err
+		}
+		slices.Reverse(img.Frames)
+		slices.Reverse(img.Delays)
+		return nil
+	}
+}
+
+// Speed changes the playback speed of the animation by factor.
+// Since GIFs cannot have delays shorter than minGIFDelay,
+// frames are dropped and their time is given to the previous frame when speeding up too much.
+func Speed(factor float64) Transform {
+	return func(img *Image) error {
+		if err := requireAnimated(img, "speed"); err != nil {
+			return err
+		}
+		var (
+			frames []*image.NRGBA
+			delays []float64
+		)
+		for i, f := range img.Frames {
+			d := img.Delays[i]
+			if d < minGIFDelay {
+				d = defaultGIFDelay
+			}
+			scaled := float64(d) / factor
+			if n := len(delays); n > 0 && delays[n-1] < minGIFDelay {
+				delays[n-1] += scaled
+				continue
+			}
+			frames = append(frames, f)
+			delays = append(delays, scaled)
+		}
+
+		img.Frames = frames
+		img.Delays = make([]int, len(delays))
+		for i, d := range delays {
+			img.Delays[i] = max(minGIFDelay, int(math.Round(d)))
+		}
+		return nil
+	}
+}
+
+// Loop sets how many times the animation is played. 0 means forever.
+func Loop(times int) Transform {
+	return func(img *Image) error {
+		if err := requireAnimated(img, "loop"); err != nil {
+			return err
+		}
+		switch {
+		case times < 0:
+			return errors.New("Loop count must not be negative.")
+		case times == 0:
+			img.LoopCount = 0
+		case times == 1:
+			img.LoopCount = -1
+		default:
+			img.LoopCount = times - 1
+		}
+		return nil
+	}
+}
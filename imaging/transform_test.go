@@ -0,0 +1,164 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+// newTestImage creates a still image of w x h whose pixel (x, y) has R = x and G = y.
+func newTestImage(w, h int) *Image {
+	f := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			f.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 0xff})
+		}
+	}
+	return &Image{Frames: []*image.NRGBA{f}}
+}
+
+func TestTransforms(t *testing.T) {
+	tests := []struct {
+		name string
+		t    Transform
+		// w and h are the size after the transform, and (x, y) is where the pixel (0, 0) goes.
+		w, h, x, y int
+	}{
+		{"mirror", Mirror(), 3, 2, 2, 0},
+		{"flip", Flip(), 3, 2, 0, 1},
+		{"rotate 90", Rotate(90), 2, 3, 1, 0},
+		{"rotate 180", Rotate(180), 3, 2, 2, 1},
+		{"rotate 270", Rotate(-90), 2, 3, 0, 2},
+		{"rotate 360", Rotate(360), 3, 2, 0, 0},
+	}
+	for _, tc := range tests {
+		img := newTestImage(3, 2)
+		if err := img.Apply(tc.t); err != nil {
+			t.Errorf("%s failed: %v", tc.name, err)
+			continue
+		}
+		f := img.Frames[0]
+		if b := f.Bounds(); b.Dx() != tc.w || b.Dy() != tc.h {
+			t.Errorf("%s resized the image to %dx%d, want %dx%d", tc.name, b.Dx(), b.Dy(), tc.w, tc.h)
+			continue
+		}
+		if c := f.NRGBAAt(tc.x, tc.y); c.R != 0 || c.G != 0 {
+			t.Errorf("%s put %v at (%d, %d), want the pixel at (0, 0)", tc.name, c, tc.x, tc.y)
+		}
+	}
+
+	if err := newTestImage(3, 2).Apply(Rotate(45)); err == nil {
+		t.Error("rotating by 45 degrees succeeded")
+	}
+}
+
+func TestGrayscale(t *testing.T) {
+	img := newTestImage(3, 2)
+	img.Frames[0].SetNRGBA(0, 0, color.NRGBA{R: 255, A: 0x40})
+	if err := img.Apply(Grayscale()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(img.Frames[0].Pix); i += 4 {
+		p := img.Frames[0].Pix[i : i+4]
+		if p[0] != p[1] || p[1] != p[2] {
+			t.Fatalf("the pixel %v is not gray", p)
+		}
+	}
+	if a := img.Frames[0].NRGBAAt(0, 0).A; a != 0x40 {
+		t.Errorf("the alpha is %#x after grayscale, want 0x40", a)
+	}
+}
+
+func TestScale(t *testing.T) {
+	img := newTestImage(10, 4)
+	if err := img.Apply(Scale(1.5)); err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Frames[0].Bounds(); b.Dx() != 15 || b.Dy() != 6 {
+		t.Errorf("the scaled image is %dx%d, want 15x6", b.Dx(), b.Dy())
+	}
+
+	for _, factor := range []float64{0.01, 1000} {
+		if err := newTestImage(10, 4).Apply(Scale(factor)); err == nil {
+			t.Errorf("scaling by %g succeeded", factor)
+		}
+	}
+}
+
+// newTestAnimation creates an animated image whose frame i has R = i.
+func newTestAnimation(delays ...int) *Image {
+	img := &Image{Animated: true, Delays: delays}
+	for i := range delays {
+		f := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+		f.SetNRGBA(0, 0, color.NRGBA{R: uint8(i), A: 0xff})
+		img.Frames = append(img.Frames, f)
+	}
+	return img
+}
+
+func frameIDs(img *Image) []int {
+	var ids []int
+	for _, f := range img.Frames {
+		ids = append(ids, int(f.NRGBAAt(0, 0).R))
+	}
+	return ids
+}
+
+func TestAnimationTransforms(t *testing.T) {
+	tests := []struct {
+		name       string
+		delays     []int
+		t          Transform
+		wantFrames []int
+		wantDelays []int
+	}{
+		{"reverse", []int{5, 10, 20}, Reverse(), []int{2, 1, 0}, []int{20, 10, 5}},
+		{"slow down", []int{5, 10}, Speed(0.5), []int{0, 1}, []int{10, 20}},
+		{"speed up", []int{10, 20}, Speed(2), []int{0, 1}, []int{5, 10}},
+		// The delays shorter than minGIFDelay are played as defaultGIFDelay.
+		{"default delay", []int{0, 1}, Speed(2), []int{0, 1}, []int{5, 5}},
+		// Too short frames are merged into the previous ones.
+		{"drop frames", []int{2, 2, 2, 2, 2, 2, 2, 2}, Speed(4), []int{0, 4}, []int{2, 2}},
+	}
+	for _, tc := range tests {
+		img := newTestAnimation(tc.delays...)
+		if err := img.Apply(tc.t); err != nil {
+			t.Errorf("%s failed: %v", tc.name, err)
+			continue
+		}
+		if got := frameIDs(img); !slices.Equal(got, tc.wantFrames) || !slices.Equal(img.Delays, tc.wantDelays) {
+			t.Errorf("%s gave frames %v with delays %v, want %v with %v", tc.name, got, img.Delays, tc.wantFrames, tc.wantDelays)
+		}
+	}
+}
+
+func TestLoop(t *testing.T) {
+	tests := []struct {
+		times, want int
+	}{
+		{0, 0},
+		{1, -1},
+		{3, 2},
+	}
+	for _, tc := range tests {
+		img := newTestAnimation(10, 10)
+		if err := img.Apply(Loop(tc.times)); err != nil {
+			t.Fatal(err)
+		}
+		if img.LoopCount != tc.want {
+			t.Errorf("Loop(%d) set LoopCount to %d, want %d", tc.times, img.LoopCount, tc.want)
+		}
+	}
+	if err := newTestAnimation(10).Apply(Loop(-1)); err == nil {
+		t.Error("Loop(-1) succeeded")
+	}
+}
+
+func TestAnimationTransformsOnStill(t *testing.T) {
+	for _, tr := range []Transform{Reverse(), Speed(2), Loop(2)} {
+		if err := newTestImage(1, 1).Apply(tr); err == nil {
+			t.Error("an animation transform succeeded on a still image")
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"discordsticker/imaging"
+	"discordsticker/sticker"
+	"discordsticker/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	minPostScale = 0.1
+	maxPostScale = 4.0
+	minPostSpeed = 0.1
+	maxPostSpeed = 10.0
+
+	// maxPostFrames and maxUploadSize are checked against the rendered stickers before they are posted.
+	maxPostFrames = 500
+	maxUploadSize = 10 << 20
+
+	// renderCacheSize is the total size of the rendered stickers kept in memory.
+	renderCacheSize = 64 << 20
+)
+
+// postOptions holds the modifiers applied to a sticker at post time.
+type postOptions struct {
+	caption    string
+	captionPos imaging.CaptionPosition
+
+	mirror bool
+	flip   bool
+	rotate int
+	gray   bool
+	scale  float64
+
+	// GIF only modifiers.
+	reverse bool
+	speed   float64
+	loop    int
+	loopSet bool
+}
+
+// transforms returns the pipeline of the image transforms.
+// The order is fixed so that the same set of flags always gives the same result.
+func (o postOptions) transforms() []imaging.Transform {
+	var ts []imaging.Transform
+	if o.mirror {
+		ts = append(ts, imaging.Mirror())
+	}
+	if o.flip {
+		ts = append(ts, imaging.Flip())
+	}
+	if o.rotate != 0 {
+		ts = append(ts, imaging.Rotate(o.rotate))
+	}
+	if o.gray {
+		ts = append(ts, imaging.Grayscale())
+	}
+	if o.scale != 0 {
+		ts = append(ts, imaging.Scale(o.scale))
+	}
+	if o.reverse {
+		ts = append(ts, imaging.Reverse())
+	}
+	if o.speed != 0 {
+		ts = append(ts, imaging.Speed(o.speed))
+	}
+	if o.loopSet {
+		ts = append(ts, imaging.Loop(o.loop))
+	}
+	return ts
+}
+
+func (o postOptions) empty() bool {
+	return o.caption == "" && len(o.transforms()) == 0
+}
+
+// flags returns the canonical flags that reproduce o, excluding the caption.
+func (o postOptions) flags() string {
+	var fs []string
+	if o.mirror {
+		fs = append(fs, "--mirror")
+	}
+	if o.flip {
+		fs = append(fs, "--flip")
+	}
+	if o.rotate != 0 {
+		fs = append(fs, "--rotate", strconv.Itoa(o.rotate))
+	}
+	if o.gray {
+		fs = append(fs, "--gray")
+	}
+	if o.scale != 0 {
+		fs = append(fs, "--x"+strconv.FormatFloat(o.scale, 'g', -1, 64))
+	}
+	if o.reverse {
+		fs = append(fs, "--reverse")
+	}
+	if o.speed != 0 {
+		fs = append(fs, "--speed", strconv.FormatFloat(o.speed, 'g', -1, 64))
+	}
+	if o.loopSet {
+		fs = append(fs, "--loop", strconv.Itoa(o.loop))
+	}
+	if o.caption != "" && o.captionPos == imaging.CaptionTop {
+		fs = append(fs, "--top")
+	}
+	return strings.Join(fs, " ")
+}
+
+func (o *postOptions) setRotate(degree int) error {
+	if degree%90 != 0 {
+		return fmt.Errorf("Invalid rotation `%d`. Expect 90, 180 or 270.", degree)
+	}
+	o.rotate = ((degree % 360) + 360) % 360
+	return nil
+}
+
+func (o *postOptions) setScale(factor float64) error {
+	if !(factor >= minPostScale && factor <= maxPostScale) {
+		return fmt.Errorf("Invalid scale `%g`. Expect a factor between %g and %g, e.g. `--x2`.", factor, minPostScale, maxPostScale)
+	}
+	if factor == 1 {
+		factor = 0
+	}
+	o.scale = factor
+	return nil
+}
+
+func (o *postOptions) setSpeed(factor float64) error {
+	if !(factor >= minPostSpeed && factor <= maxPostSpeed) {
+		return fmt.Errorf("Invalid speed `%g`. Expect a factor between %g and %g.", factor, minPostSpeed, maxPostSpeed)
+	}
+	if factor == 1 {
+		factor = 0
+	}
+	o.speed = factor
+	return nil
+}
+
+func (o *postOptions) setLoop(times int) error {
+	if times < 0 {
+		return fmt.Errorf("Invalid loop count `%d`. Expect 0 for looping forever, or a positive number.", times)
+	}
+	o.loop = times
+	o.loopSet = true
+	return nil
+}
+
+// parsePostFlags applies the flags in args to opts, and returns the arguments which are not flags.
+// Flags taking a value consume the next argument. The arguments after "--" are never flags.
+func parsePostFlags(args []string, opts *postOptions) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			return append(rest, args[i+1:]...), nil
+		}
+		if !strings.HasPrefix(a, "--") {
+			rest = append(rest, a)
+			continue
+		}
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("Option `%s` requires a value.", a)
+			}
+			i++
+			return args[i], nil
+		}
+
+		switch {
+		case a == "--top":
+			opts.captionPos = imaging.CaptionTop
+		case a == "--bottom":
+			opts.captionPos = imaging.CaptionBottom
+		case a == "--mirror":
+			opts.mirror = true
+		case a == "--flip":
+			opts.flip = true
+		case a == "--gray" || a == "--grey":
+			opts.gray = true
+		case a == "--rotate":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			degree, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid rotation `%s`. Expect 90, 180 or 270.", v)
+			}
+			if err := opts.setRotate(degree); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(a, "--x"):
+			factor, err := strconv.ParseFloat(a[len("--x"):], 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid scale `%s`. Expect something like `--x2` or `--x0.5`.", a)
+			}
+			if err := opts.setScale(factor); err != nil {
+				return nil, err
+			}
+		case a == "--reverse":
+			opts.reverse = true
+		case a == "--speed":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			factor, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid speed `%s`. Expect a number like `2` or `0.5`.", v)
+			}
+			if err := opts.setSpeed(factor); err != nil {
+				return nil, err
+			}
+		case a == "--loop":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			times, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid loop count `%s`. Expect an integer.", v)
+			}
+			if err := opts.setLoop(times); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Unknown option `%s`. Put `--` before the patterns starting with `--`.", a)
+		}
+	}
+	return rest, nil
+}
+
+var closingQuotes = map[rune]rune{'"': '"', '“': '”'}
+
+// parsePostArgs splits the arguments of a post command into the pattern and the modifiers.
+// Quoted text is taken as the caption, and words starting with "--" are taken as flags until a "--" word.
+func parsePostArgs(arg string) (string, postOptions, error) {
+	var (
+		words    []string
+		opts     postOptions
+		captions int
+	)
+	rs := []rune(arg)
+	for i := 0; i < len(rs); {
+		if unicode.IsSpace(rs[i]) {
+			i++
+			continue
+		}
+		if closing, ok := closingQuotes[rs[i]]; ok {
+			j := i + 1
+			for j < len(rs) && rs[j] != closing {
+				j++
+			}
+			if j == len(rs) {
+				return "", postOptions{}, errors.New("The caption is not closed with a quote.")
+			}
+			opts.caption = strings.TrimSpace(string(rs[i+1 : j]))
+			captions++
+			i = j + 1
+			continue
+		}
+		j := i
+		for j < len(rs) && !unicode.IsSpace(rs[j]) {
+			if _, ok := closingQuotes[rs[j]]; ok {
+				break
+			}
+			j++
+		}
+		words = append(words, string(rs[i:j]))
+		i = j
+	}
+	if captions > 1 {
+		return "", postOptions{}, errors.New("Only one caption is allowed.")
+	}
+	patterns, err := parsePostFlags(words, &opts)
+	if err != nil {
+		return "", postOptions{}, err
+	}
+	return strings.Join(patterns, " "), opts, nil
+}
+
+// commandPostOptions collects the post modifiers from the options of an application command.
+func commandPostOptions(options []*discordgo.ApplicationCommandInteractionDataOption) (postOptions, error) {
+	var opts postOptions
+	for _, o := range options {
+		switch o.Name {
+		case "caption":
+			opts.caption = strings.TrimSpace(o.StringValue())
+		case "caption_position":
+			if o.StringValue() == "top" {
+				opts.captionPos = imaging.CaptionTop
+			}
+		case "mirror":
+			opts.mirror = o.BoolValue()
+		case "flip":
+			opts.flip = o.BoolValue()
+		case "gray":
+			opts.gray = o.BoolValue()
+		case "rotate":
+			if err := opts.setRotate(int(o.IntValue())); err != nil {
+				return postOptions{}, err
+			}
+		case "scale":
+			if err := opts.setScale(o.FloatValue()); err != nil {
+				return postOptions{}, err
+			}
+		case "reverse":
+			opts.reverse = o.BoolValue()
+		case "speed":
+			if err := opts.setSpeed(o.FloatValue()); err != nil {
+				return postOptions{}, err
+			}
+		case "loop":
+			if err := opts.setLoop(int(o.IntValue())); err != nil {
+				return postOptions{}, err
+			}
+		}
+	}
+	return opts, nil
+}
+
+// encodePostButtonID composes the custom ID of a button which posts the sticker with opts.
+// The caption is put at the end as-is since it may contain any character.
+func encodePostButtonID(stickerID string, opts postOptions) string {
+	if opts.empty() {
+		return stickerID
+	}
+	return stickerID + "\n" + opts.flags() + "\n" + opts.caption
+}
+
+// decodePostButtonID is the inverse of encodePostButtonID.
+func decodePostButtonID(id string) (string, postOptions, error) {
+	parts := strings.SplitN(id, "\n", 3)
+	if len(parts) == 1 {
+		return id, postOptions{}, nil
+	}
+	if len(parts) != 3 {
+		return "", postOptions{}, fmt.Errorf("malformed button ID %q", id)
+	}
+	var opts postOptions
+	if rest, err := parsePostFlags(strings.Fields(parts[1]), &opts); err != nil {
+		return "", postOptions{}, err
+	} else if len(rest) != 0 {
+		return "", postOptions{}, fmt.Errorf("malformed button ID %q", id)
+	}
+	opts.caption = parts[2]
+	return parts[0], opts, nil
+}
+
+const (
+	maxButtonColumnCount = 5
+	maxButtonsPerMessage = 5 * maxButtonColumnCount
+	maxCustomIDLen       = 100
+)
+
+// postButtons composes the rows of buttons which post ss with opts.
+// At most maxButtonsPerMessage stickers fit in a message.
+func postButtons(ss []*sticker.Sticker, opts postOptions) []discordgo.MessageComponent {
+	var rows []discordgo.MessageComponent
+	for rowBegin := 0; rowBegin < len(ss); rowBegin += maxButtonColumnCount {
+		var buttons []discordgo.MessageComponent
+		for i := rowBegin; i < min(rowBegin+maxButtonColumnCount, len(ss)); i++ {
+			style := discordgo.PrimaryButton
+			if i%2 != 0 {
+				style = discordgo.SecondaryButton
+			}
+			buttons = append(buttons, discordgo.Button{
+				Label:    ss[i].Name(),
+				Style:    style,
+				CustomID: encodePostButtonID(ss[i].ID(), opts),
+			})
+		}
+		rows = append(rows, discordgo.ActionsRow{Components: buttons})
+	}
+	return rows
+}
+
+type renderedSticker struct {
+	data []byte
+	ext  string
+}
+
+// renderCache caches the rendered stickers by the file and the modifiers.
+var renderCache = utils.NewLRUCache[renderedSticker](renderCacheSize)
+
+// openSticker opens the image at path with opts applied.
+// The original file is returned if no modifier is given.
+// sticker.UninformableErr is returned when there is an internal error occurs;
+// Otherwise the error is caused by the modifiers and can be shown to the user.
+func openSticker(path string, opts postOptions) (io.ReadCloser, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Println("Failed to open the image:", err)
+		return nil, "", sticker.UninformableErr
+	}
+	if opts.empty() {
+		return f, filepath.Ext(path), nil
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		log.Println("Failed to stat the image:", err)
+		return nil, "", sticker.UninformableErr
+	}
+	// The modification time is included so that a replaced file is not served from the cache.
+	key := strings.Join([]string{path, fi.ModTime().String(), opts.flags(), opts.caption}, "\n")
+	if r, ok := renderCache.Get(key); ok {
+		return io.NopCloser(bytes.NewReader(r.data)), r.ext, nil
+	}
+
+	img, err := decodeSticker(f, filepath.Ext(path))
+	if err != nil {
+		return nil, "", err
+	}
+	if err := img.Apply(opts.transforms()...); err != nil {
+		return nil, "", err
+	}
+	if len(img.Frames) > maxPostFrames {
+		return nil, "", fmt.Errorf("Too many frames. Expect <= %d, got %d.", maxPostFrames, len(img.Frames))
+	}
+	if opts.caption != "" {
+		if err := img.DrawCaption(opts.caption, opts.captionPos); err != nil {
+			log.Println("Failed to draw the caption:", err)
+			return nil, "", sticker.UninformableErr
+		}
+	}
+	data, ext, err := encodeSticker(img)
+	if err != nil {
+		return nil, "", err
+	}
+	renderCache.Add(key, renderedSticker{data: data, ext: ext}, len(data))
+	return io.NopCloser(bytes.NewReader(data)), ext, nil
+}
+
+// decodeSticker decodes the image in r with the same error convention as openSticker.
+func decodeSticker(r io.Reader, ext string) (*imaging.Image, error) {
+	img, err := imaging.Decode(r, ext)
+	if err == imaging.ErrTooLarge {
+		return nil, err
+	}
+	if err != nil {
+		log.Println("Failed to decode the image:", err)
+		return nil, sticker.UninformableErr
+	}
+	return img, nil
+}
+
+// encodeSticker encodes img and makes sure the result can be uploaded.
+// The error convention is the same as openSticker.
+func encodeSticker(img *imaging.Image) ([]byte, string, error) {
+	var buf bytes.Buffer
+	ext, err := img.Encode(&buf)
+	if err != nil {
+		log.Println("Failed to encode the image:", err)
+		return nil, "", sticker.UninformableErr
+	}
+	if buf.Len() > maxUploadSize {
+		return nil, "", fmt.Errorf("The result is too large to upload. Expect < %dB, got %d.", maxUploadSize, buf.Len())
+	}
+	return buf.Bytes(), ext, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	"discordsticker/imaging"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestParsePostArgs(t *testing.T) {
+	tests := []struct {
+		arg     string
+		pattern string
+		opts    postOptions
+		wantErr bool
+	}{
+		{arg: "miko", pattern: "miko"},
+		{arg: "  miko   fubuki ", pattern: "miko fubuki"},
+		{arg: `miko "hello world"`, pattern: "miko", opts: postOptions{caption: "hello world"}},
+		{arg: `miko“ hi ”--top`, pattern: "miko", opts: postOptions{caption: "hi", captionPos: imaging.CaptionTop}},
+		{arg: "miko --mirror --flip --gray", pattern: "miko", opts: postOptions{mirror: true, flip: true, gray: true}},
+		{arg: "--grey miko", pattern: "miko", opts: postOptions{gray: true}},
+		{arg: "miko --rotate -90", pattern: "miko", opts: postOptions{rotate: 270}},
+		{arg: "miko --rotate 360", pattern: "miko"},
+		{arg: "miko --x2", pattern: "miko", opts: postOptions{scale: 2}},
+		{arg: "miko --x1", pattern: "miko"},
+		{arg: "miko --reverse --speed 0.5 --loop 0", pattern: "miko", opts: postOptions{reverse: true, speed: 0.5, loopSet: true}},
+		{arg: "miko -- --mirror", pattern: "miko --mirror"},
+		{arg: "--flip -- --odd name", pattern: "--odd name", opts: postOptions{flip: true}},
+		{arg: `miko "unclosed`, wantErr: true},
+		{arg: `miko "a" "b"`, wantErr: true},
+		{arg: "miko --unknown", wantErr: true},
+		{arg: "miko --rotate", wantErr: true},
+		{arg: "miko --rotate 45", wantErr: true},
+		{arg: "miko --rotate x", wantErr: true},
+		{arg: "miko --x9", wantErr: true},
+		{arg: "miko --xx", wantErr: true},
+		{arg: "miko --speed 100", wantErr: true},
+		{arg: "miko --loop -1", wantErr: true},
+	}
+	for _, tc := range tests {
+		pattern, opts, err := parsePostArgs(tc.arg)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parsePostArgs(%q) succeeded, want an error", tc.arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePostArgs(%q) failed: %v", tc.arg, err)
+			continue
+		}
+		if pattern != tc.pattern || opts != tc.opts {
+			t.Errorf("parsePostArgs(%q) = %q, %+v; want %q, %+v", tc.arg, pattern, opts, tc.pattern, tc.opts)
+		}
+	}
+}
+
+func TestPostButtonID(t *testing.T) {
+	tests := []struct {
+		args string
+		id   string
+	}{
+		{args: "", id: "123"},
+		{args: `"hello"`, id: "123\n\nhello"},
+		{args: `"multi` + "\n" + `line" --top`, id: "123\n--top\nmulti\nline"},
+		{args: "--flip --mirror --x0.5", id: "123\n--mirror --flip --x0.5\n"},
+		{args: `--rotate 90 --gray --reverse --speed 2 --loop 3 "a b"`, id: "123\n--rotate 90 --gray --reverse --speed 2 --loop 3\na b"},
+	}
+	for _, tc := range tests {
+		_, opts, err := parsePostArgs(tc.args)
+		if err != nil {
+			t.Fatalf("parsePostArgs(%q) failed: %v", tc.args, err)
+		}
+		id := encodePostButtonID("123", opts)
+		if id != tc.id {
+			t.Errorf("encodePostButtonID(%q) = %q, want %q", tc.args, id, tc.id)
+		}
+		stickerID, decoded, err := decodePostButtonID(id)
+		if err != nil {
+			t.Errorf("decodePostButtonID(%q) failed: %v", id, err)
+			continue
+		}
+		if stickerID != "123" || decoded != opts {
+			t.Errorf("decodePostButtonID(%q) = %q, %+v; want %q, %+v", id, stickerID, decoded, "123", opts)
+		}
+	}
+}
+
+func TestDecodePostButtonIDMalformed(t *testing.T) {
+	for _, id := range []string{
+		"123\n--mirror",
+		"123\n--unknown\n",
+		"123\nmiko\n",
+		"123\n--rotate\n",
+	} {
+		if _, _, err := decodePostButtonID(id); err == nil {
+			t.Errorf("decodePostButtonID(%q) succeeded, want an error", id)
+		}
+	}
+}
+
+func TestCommandPostOptions(t *testing.T) {
+	option := func(name string, typ discordgo.ApplicationCommandOptionType, value interface{}) *discordgo.ApplicationCommandInteractionDataOption {
+		return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: typ, Value: value}
+	}
+	opts, err := commandPostOptions([]*discordgo.ApplicationCommandInteractionDataOption{
+		option("pattern", discordgo.ApplicationCommandOptionString, "miko"),
+		option("caption", discordgo.ApplicationCommandOptionString, " hi "),
+		option("caption_position", discordgo.ApplicationCommandOptionString, "top"),
+		option("mirror", discordgo.ApplicationCommandOptionBoolean, true),
+		option("rotate", discordgo.ApplicationCommandOptionInteger, float64(-90)),
+		option("scale", discordgo.ApplicationCommandOptionNumber, 1.5),
+		option("loop", discordgo.ApplicationCommandOptionInteger, float64(2)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := postOptions{caption: "hi", captionPos: imaging.CaptionTop, mirror: true, rotate: 270, scale: 1.5, loop: 2, loopSet: true}
+	if opts != want {
+		t.Errorf("commandPostOptions() = %+v, want %+v", opts, want)
+	}
+
+	for _, o := range []*discordgo.ApplicationCommandInteractionDataOption{
+		option("rotate", discordgo.ApplicationCommandOptionInteger, float64(45)),
+		option("scale", discordgo.ApplicationCommandOptionNumber, 10.0),
+		option("speed", discordgo.ApplicationCommandOptionNumber, 0.0),
+		option("loop", discordgo.ApplicationCommandOptionInteger, float64(-1)),
+	} {
+		if _, err := commandPostOptions([]*discordgo.ApplicationCommandInteractionDataOption{o}); err == nil {
+			t.Errorf("commandPostOptions(%s=%v) succeeded, want an error", o.Name, o.Value)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"discordsticker/audit"
+	"discordsticker/sticker"
+)
+
+// quotaWindow is the period of the daily quotas. The window is rolling rather than reset at midnight.
+const quotaWindow = 24 * time.Hour
+
+// quotaActions are the audit actions which count towards the daily quotas.
+var quotaActions = []string{audit.ActionAdd, audit.ActionAddText, audit.ActionRename, audit.ActionSubmit}
+
+// quotaChecker enforces the daily quotas of the changes and the number of the stickers a user can own.
+// The changes are counted from the audit log, so the quotas survive restarts.
+type quotaChecker struct {
+	al *audit.Log
+	// gc is loaded on every check since it's swapped on reloading the config.
+	gc       *atomic.Pointer[guildConfigManager]
+	maxOwned int
+}
+
+// usedSince returns the number of the counted changes matching match since the time,
+// and when the oldest of them leaves the window.
+func (q *quotaChecker) usedSince(since time.Time, match func(*audit.Entry) bool) (int, time.Time) {
+	es := q.al.EntriesSince(since, func(e *audit.Entry) bool {
+		return slices.Contains(quotaActions, e.Action) && match(e)
+	})
+	if len(es) == 0 {
+		return 0, time.Time{}
+	}
+	return len(es), es[len(es)-1].Time.Add(quotaWindow)
+}
+
+// check returns an error if the user of h has no quota for one more change.
+// owning is true if the change adds a sticker owned by the user.
+// Otherwise it returns a note of the quotas left after the change.
+// The caller must hold the lock of sm.
+func (q *quotaChecker) check(h handler, sm *sticker.Manager, owning bool) (string, error) {
+	gc := q.gc.Load()
+	if slices.Contains(gc.owners, h.userID()) {
+		return "", nil
+	}
+
+	var notes []string
+	now := time.Now()
+	perUser, perGuild := gc.quotas(h.guildID())
+	if perUser > 0 {
+		used, free := q.usedSince(now.Add(-quotaWindow), func(e *audit.Entry) bool { return e.ActorID == h.userID() })
+		if used >= perUser {
+			return "", errors.New(fmt.Sprintf("You have reached the limit of %d changes per day. Please try again in %s.",
+				perUser, free.Sub(now).Round(time.Minute)))
+		}
+		notes = append(notes, fmt.Sprintf("%d of your %d daily changes", perUser-used-1, perUser))
+	}
+	if perGuild > 0 && h.guildID() != "" {
+		used, free := q.usedSince(now.Add(-quotaWindow), func(e *audit.Entry) bool { return e.GuildID == h.guildID() })
+		if used >= perGuild {
+			return "", errors.New(fmt.Sprintf("This guild has reached the limit of %d changes per day. Please try again in %s.",
+				perGuild, free.Sub(now).Round(time.Minute)))
+		}
+		notes = append(notes, fmt.Sprintf("%d of the %d daily changes of this guild", perGuild-used-1, perGuild))
+	}
+	if owning && q.maxOwned > 0 {
+		owned := sm.OwnedBy(h.userID())
+		if owned >= q.maxOwned {
+			return "", errors.New(fmt.Sprintf("You already own %d stickers, which is the limit.", owned))
+		}
+		notes = append(notes, fmt.Sprintf("%d more stickers you can own", q.maxOwned-owned-1))
+	}
+	if len(notes) == 0 {
+		return "", nil
+	}
+	return " Left: " + strings.Join(notes, ", ") + ".", nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"discordsticker/audit"
+	"discordsticker/sticker"
+)
+
+func TestQuotaCheck(t *testing.T) {
+	al, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer al.Close()
+	sm, err := sticker.NewManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"alpha", "bravo"} {
+		if _, err := sm.AddText(text, "", text, "u1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	for _, e := range []audit.Entry{
+		// The first one is too old to count.
+		{Action: audit.ActionAdd, ActorID: "u1", GuildID: "g1", Time: now.Add(-25 * time.Hour)},
+		{Action: audit.ActionRename, ActorID: "u1", GuildID: "g1", Time: now.Add(-2 * time.Hour)},
+		{Action: audit.ActionAdd, ActorID: "u1", GuildID: "g1", Time: now.Add(-time.Hour)},
+		// Approvals don't count.
+		{Action: audit.ActionApprove, ActorID: "u1", GuildID: "g1", Time: now.Add(-time.Hour)},
+		{Action: audit.ActionAddText, ActorID: "u2", GuildID: "g1", Time: now.Add(-time.Hour)},
+		{Action: audit.ActionAddText, ActorID: "u2", GuildID: "g2", Time: now.Add(-time.Hour)},
+	} {
+		if err := al.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		conf     guildConfig
+		maxOwned int
+		h        *testHandler
+		owning   bool
+		// wantErr is a substring of the error, or empty if the check should pass.
+		wantErr  string
+		wantNote string
+	}{
+		{name: "no quota", h: &testHandler{user: "u1", guild: "g1"}},
+		{
+			name:     "user quota left",
+			conf:     guildConfig{dailyQuotaPerUser: 3},
+			h:        &testHandler{user: "u1", guild: "g1"},
+			wantNote: " Left: 0 of your 3 daily changes.",
+		},
+		{
+			name:    "user quota used up",
+			conf:    guildConfig{dailyQuotaPerUser: 2},
+			h:       &testHandler{user: "u1", guild: "g1"},
+			wantErr: "limit of 2 changes per day. Please try again in 22h0m0s",
+		},
+		{
+			name:     "guild quota left",
+			conf:     guildConfig{dailyQuotaPerGuild: 4},
+			h:        &testHandler{user: "u3", guild: "g2"},
+			wantNote: " Left: 2 of the 4 daily changes of this guild.",
+		},
+		{
+			name:    "guild quota used up",
+			conf:    guildConfig{dailyQuotaPerGuild: 3},
+			h:       &testHandler{user: "u3", guild: "g1"},
+			wantErr: "This guild has reached the limit of 3 changes per day.",
+		},
+		{
+			name: "guild quota in DM",
+			conf: guildConfig{dailyQuotaPerGuild: 1},
+			h:    &testHandler{user: "u3"},
+		},
+		{
+			name:     "owner exempted",
+			conf:     guildConfig{dailyQuotaPerUser: 1},
+			maxOwned: 1,
+			h:        &testHandler{user: "u2", guild: "g1"},
+			owning:   true,
+		},
+		{
+			name:     "owned stickers left",
+			maxOwned: 3,
+			h:        &testHandler{user: "u1", guild: "g1"},
+			owning:   true,
+			wantNote: " Left: 0 more stickers you can own.",
+		},
+		{
+			name:     "owned stickers not counted for renames",
+			maxOwned: 2,
+			h:        &testHandler{user: "u1", guild: "g1"},
+		},
+		{
+			name:     "owned stickers used up",
+			maxOwned: 2,
+			h:        &testHandler{user: "u1", guild: "g1"},
+			owning:   true,
+			wantErr:  "You already own 2 stickers",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var gc atomic.Pointer[guildConfigManager]
+			gc.Store(newTestGuildConfigManager(t, tc.conf, nil, "u2"))
+			q := &quotaChecker{al: al, gc: &gc, maxOwned: tc.maxOwned}
+
+			note, err := q.check(tc.h, sm, tc.owning)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("check() = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("check() failed: %v", err)
+			}
+			if note != tc.wantNote {
+				t.Errorf("check() = %q, want %q", note, tc.wantNote)
+			}
+		})
+	}
+}
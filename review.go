@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"discordsticker/audit"
+	"discordsticker/sticker"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// reviewButtonPrefix distinguishes the review buttons from the post buttons, whose IDs start with the sticker IDs.
+const reviewButtonPrefix = "review\n"
+
+func encodeReviewButtonID(approve bool, pendingID string) string {
+	action := "reject"
+	if approve {
+		action = "approve"
+	}
+	return reviewButtonPrefix + action + "\n" + pendingID
+}
+
+// decodeReviewButtonID is the inverse of encodeReviewButtonID. ok is false if id is not a review button.
+func decodeReviewButtonID(id string) (approve bool, pendingID string, ok bool) {
+	rest, found := strings.CutPrefix(id, reviewButtonPrefix)
+	if !found {
+		return false, "", false
+	}
+	action, pendingID, found := strings.Cut(rest, "\n")
+	if !found || (action != "approve" && action != "reject") {
+		return false, "", false
+	}
+	return action == "approve", pendingID, true
+}
+
+func reviewButtons(pendingID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Approve",
+				Style:    discordgo.SuccessButton,
+				CustomID: encodeReviewButtonID(true, pendingID),
+			},
+			discordgo.Button{
+				Label:    "Reject",
+				Style:    discordgo.DangerButton,
+				CustomID: encodeReviewButtonID(false, pendingID),
+			},
+		},
+	}}
+}
+
+// postReview sends the pending sticker with the review buttons to the mod channel.
+func postReview(s *discordgo.Session, channelID string, p *sticker.Pending) error {
+	msg := &discordgo.MessageSend{
+		Content:         fmt.Sprintf("<@%s> submitted `%s`.", p.Submitter(), p.Name()),
+		Components:      reviewButtons(p.ID()),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	if p.Ext() == ".txt" {
+		text, err := os.ReadFile(p.Path())
+		if err != nil {
+			return err
+		}
+		msg.Content += "\n" + string(text)
+	} else {
+		f, err := os.Open(p.Path())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		msg.Files = []*discordgo.File{{
+			Name:        "sticker" + p.Ext(),
+			ContentType: "image/" + p.Ext()[1:],
+			Reader:      f,
+		}}
+	}
+	_, err := s.ChannelMessageSendComplex(channelID, msg)
+	return err
+}
+
+// handleSubmit puts a new sticker in the approval queue with submit, and asks the moderators to review it.
+// url is the source of the image, which is downloaded and passed to submit; It's empty for texts and submit gets nil.
+// Neither the download nor the review message holds the lock of sm.
+func handleSubmit(h handler, s *discordgo.Session, sm *sticker.Manager, al *audit.Log, qc *quotaChecker, modChannelID, url string, submit func(*sticker.Download) (*sticker.Pending, error)) {
+	replyErr := func(err error) {
+		if err != sticker.UninformableErr {
+			h.replyPublic(err.Error())
+		} else {
+			h.replyPublic("Something goes wrong here! Please contact the admin.")
+		}
+	}
+
+	var d *sticker.Download
+	if url != "" {
+		// Check the quotas first so that a refused submission doesn't download anything.
+		// They are checked again with the submission since the lock is released in between.
+		sm.RLock()
+		_, err := qc.check(h, sm, true)
+		sm.RUnlock()
+		if err != nil {
+			h.replyPublic(err.Error())
+			return
+		}
+		if d, err = sm.DownloadImage(url); err != nil {
+			replyErr(err)
+			return
+		}
+		defer d.Close()
+	}
+
+	p, note, err := func() (*sticker.Pending, string, error) {
+		sm.Lock()
+		defer sm.Unlock()
+
+		note, err := qc.check(h, sm, true)
+		if err != nil {
+			return nil, "", err
+		}
+		p, err := submit(d)
+		return p, note, err
+	}()
+	if err != nil {
+		replyErr(err)
+		return
+	}
+	if err := postReview(s, modChannelID, p); err != nil {
+		log.Println("Failed to post the review message:", err)
+		sm.Lock()
+		if _, err := sm.RejectSticker(p.ID()); err != nil {
+			log.Println("Failed to drop the pending sticker:", err)
+		}
+		sm.Unlock()
+		h.replyPublic("Something goes wrong here! Please contact the admin.")
+		return
+	}
+
+	log.Printf("%s `submit` %q", h.userInfo(), p.Name())
+	audited(h, al, audit.Entry{Action: audit.ActionSubmit, StickerID: p.ID(), NewName: p.Name(), URL: url}, p.Path())
+	h.replyPublic(fmt.Sprintf("Thanks! Sticker `%s` is waiting for the approval of the moderators.%s", p.Name(), note))
+}
+
+// handleReview approves or rejects the pending sticker, and removes the buttons from the review message.
+// If the approval fails, e.g. the name conflicts with a sticker added in the meantime, the buttons are kept.
+func handleReview(h *commandHandler, sm *sticker.Manager, al *audit.Log, approve bool, pendingID string) {
+	// The review message is updated after releasing the lock, so that Discord doesn't block the library.
+	name, verdict, ok := func() (string, string, bool) {
+		sm.Lock()
+		defer sm.Unlock()
+
+		if approve {
+			st, err := sm.ApproveSticker(pendingID)
+			if err != nil {
+				if err != sticker.UninformableErr {
+					h.replyPrivate(err.Error() + " Please ask the submitter to add it again with another name, or reject it.")
+				} else {
+					h.replyPrivate("Something goes wrong here! Please contact the admin.")
+				}
+				return "", "", false
+			}
+			audited(h, al, audit.Entry{Action: audit.ActionApprove, StickerID: st.ID(), NewName: st.Name()}, st.Path())
+			return st.Name(), "Approved", true
+		}
+		p, err := sm.RejectSticker(pendingID)
+		if err != nil {
+			if err != sticker.UninformableErr {
+				h.replyPrivate(err.Error())
+			} else {
+				h.replyPrivate("Something goes wrong here! Please contact the admin.")
+			}
+			return "", "", false
+		}
+		audited(h, al, audit.Entry{Action: audit.ActionReject, StickerID: p.ID(), OldName: p.Name()}, "")
+		return p.Name(), "Rejected", true
+	}()
+	if !ok {
+		return
+	}
+	log.Printf("%s `review` %q %s", h.userInfo(), name, verdict)
+
+	content := fmt.Sprintf("%s\n%s by <@%s>.", h.i.Message.Content, verdict, h.userID())
+	if _, err := h.s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:              h.i.Message.ID,
+		Channel:         h.i.ChannelID,
+		Content:         &content,
+		Components:      &[]discordgo.MessageComponent{},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}); err != nil {
+		log.Println("Failed to update the review message:", err)
+	}
+	h.replyPrivate(fmt.Sprintf("Done. %s sticker: `%s`", verdict, name))
+}
@@ -0,0 +1,237 @@
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Record is a successful post of a sticker.
+// Sticker is the name at the time of posting, while StickerID stays the same across renames.
+// Records written before the sticker IDs were introduced have no StickerID.
+type Record struct {
+	StickerID string    `json:"sticker_id,omitempty"`
+	Sticker   string    `json:"sticker"`
+	GuildID   string    `json:"guild_id,omitempty"`
+	ChannelID string    `json:"channel_id"`
+	UserID    string    `json:"user_id"`
+	Time      time.Time `json:"time"`
+}
+
+// recentWindow is how far back the records are kept in memory.
+// Queries reaching further back read the file.
+const recentWindow = 14 * 24 * time.Hour
+
+// Recorder appends every new record to a JSON lines file.
+// It keeps the totals of every sticker in every guild, and the records in recentWindow before the latest one,
+// so that the memory doesn't grow with the whole history.
+type Recorder struct {
+	mu     sync.Mutex
+	path   string
+	f      *os.File
+	totals map[string]usages
+	// recent holds every record at or after cutoff.
+	recent []Record
+	cutoff time.Time
+}
+
+// Open loads the records in path and opens it for appending.
+// The file is created if it does not exist.
+func Open(path string) (*Recorder, error) {
+	r := &Recorder{path: path, totals: make(map[string]usages)}
+	var latest time.Time
+	if err := scan(path, func(rec *Record) {
+		r.addTotal(rec)
+		r.recent = append(r.recent, *rec)
+		if rec.Time.After(latest) {
+			latest = rec.Time
+		}
+	}); err != nil {
+		return nil, err
+	}
+	r.trim(latest.Add(-recentWindow))
+
+	var err error
+	r.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// scan calls f with every record in path. A missing file has no records.
+func scan(path string, f func(*Record)) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sc := bufio.NewScanner(file)
+	for line := 1; sc.Scan(); line++ {
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			// A partial line could be left by a crash. Skip it rather than refusing to start.
+			log.Printf("Skipped a malformed record, path=%s line=%d err=%v\n", path, line, err)
+			continue
+		}
+		f(&rec)
+	}
+	return sc.Err()
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// Add appends rec to the file.
+func (r *Recorder) Add(rec Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	r.addTotal(&rec)
+	if !rec.Time.Before(r.cutoff) {
+		r.recent = append(r.recent, rec)
+	}
+	// Trim at most once a day rather than on every record.
+	if cutoff := rec.Time.Add(-recentWindow); cutoff.Sub(r.cutoff) > 24*time.Hour {
+		r.trim(cutoff)
+	}
+	return nil
+}
+
+func (r *Recorder) addTotal(rec *Record) {
+	us, ok := r.totals[rec.GuildID]
+	if !ok {
+		us = make(usages)
+		r.totals[rec.GuildID] = us
+	}
+	us.add(rec)
+}
+
+// trim drops the recent records before cutoff.
+func (r *Recorder) trim(cutoff time.Time) {
+	r.cutoff = cutoff
+	kept := r.recent[:0]
+	for _, rec := range r.recent {
+		if !rec.Time.Before(cutoff) {
+			kept = append(kept, rec)
+		}
+	}
+	clear(r.recent[len(kept):])
+	r.recent = kept
+}
+
+// Filter selects the records. Zero fields match everything.
+type Filter struct {
+	GuildID string
+	Since   time.Time
+}
+
+func (f Filter) match(rec *Record) bool {
+	if f.GuildID != "" && rec.GuildID != f.GuildID {
+		return false
+	}
+	return f.Since.IsZero() || !rec.Time.Before(f.Since)
+}
+
+// Usage is the aggregated records of a sticker.
+// Sticker is the latest recorded name.
+type Usage struct {
+	StickerID string
+	Sticker   string
+	Count     int
+	LastUsed  time.Time
+}
+
+// usages aggregates the records by sticker ID,
+// or by name for the records without the sticker ID.
+type usages map[string]*Usage
+
+func (us usages) add(rec *Record) {
+	key := "id:" + rec.StickerID
+	if rec.StickerID == "" {
+		key = "name:" + rec.Sticker
+	}
+	us.merge(key, Usage{StickerID: rec.StickerID, Sticker: rec.Sticker, Count: 1, LastUsed: rec.Time})
+}
+
+func (us usages) merge(key string, u Usage) {
+	v, ok := us[key]
+	if !ok {
+		v = &Usage{StickerID: u.StickerID}
+		us[key] = v
+	}
+	v.Count += u.Count
+	if !u.LastUsed.Before(v.LastUsed) {
+		v.Sticker = u.Sticker
+		v.LastUsed = u.LastUsed
+	}
+}
+
+// Usages aggregates the records matching f by sticker ID,
+// or by name for the records without the sticker ID.
+// The result is sorted by count in descending order; Ties are broken by name.
+// Only the queries with f.Since earlier than the records in memory read the file.
+func (r *Recorder) Usages(f Filter) ([]Usage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := make(usages)
+	switch {
+	case f.Since.IsZero():
+		for guildID, us := range r.totals {
+			if f.GuildID != "" && guildID != f.GuildID {
+				continue
+			}
+			for key, u := range us {
+				m.merge(key, *u)
+			}
+		}
+	case !f.Since.Before(r.cutoff):
+		for i := range r.recent {
+			if rec := &r.recent[i]; f.match(rec) {
+				m.add(rec)
+			}
+		}
+	default:
+		if err := scan(r.path, func(rec *Record) {
+			if f.match(rec) {
+				m.add(rec)
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := make([]Usage, 0, len(m))
+	for _, u := range m {
+		ret = append(ret, *u)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Sticker < ret[j].Sticker
+	})
+	return ret, nil
+}
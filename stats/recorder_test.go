@@ -0,0 +1,142 @@
+package stats
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func add(t *testing.T, r *Recorder, id, name, guildID string, at time.Time) {
+	t.Helper()
+	if err := r.Add(Record{StickerID: id, Sticker: name, GuildID: guildID, Time: at}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// counts returns the counts of the usages matching f by sticker name.
+func counts(t *testing.T, r *Recorder, f Filter) map[string]int {
+	t.Helper()
+	us, err := r.Usages(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]int)
+	for _, u := range us {
+		m[u.Sticker] = u.Count
+	}
+	return m
+}
+
+func TestUsages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	add(t, r, "1", "cat", "g1", t0)
+	add(t, r, "2", "dog", "g1", t0.Add(time.Hour))
+	add(t, r, "1", "kitty", "g2", t0.Add(2*time.Hour)) // Renamed.
+	add(t, r, "", "legacy", "g2", t0.Add(3*time.Hour))
+	add(t, r, "1", "kitty", "g1", t0.Add(4*time.Hour))
+
+	us, err := r.Usages(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Usage{
+		{StickerID: "1", Sticker: "kitty", Count: 3, LastUsed: t0.Add(4 * time.Hour)},
+		{StickerID: "2", Sticker: "dog", Count: 1, LastUsed: t0.Add(time.Hour)},
+		{Sticker: "legacy", Count: 1, LastUsed: t0.Add(3 * time.Hour)},
+	}
+	if !slices.Equal(us, want) {
+		t.Errorf("Usages() = %v, want %v", us, want)
+	}
+
+	tests := []struct {
+		f    Filter
+		want map[string]int
+	}{
+		{Filter{GuildID: "g1"}, map[string]int{"kitty": 2, "dog": 1}},
+		{Filter{GuildID: "g2"}, map[string]int{"kitty": 1, "legacy": 1}},
+		{Filter{Since: t0.Add(2 * time.Hour)}, map[string]int{"kitty": 2, "legacy": 1}},
+		{Filter{GuildID: "g1", Since: t0.Add(time.Hour)}, map[string]int{"kitty": 1, "dog": 1}},
+		{Filter{GuildID: "g3"}, map[string]int{}},
+	}
+	for _, tc := range tests {
+		if got := counts(t, r, tc.f); !maps.Equal(got, tc.want) {
+			t.Errorf("Usages(%+v) = %v, want %v", tc.f, got, tc.want)
+		}
+	}
+}
+
+func TestUsagesBeyondRecentWindow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add(t, r, "1", "old", "g1", t0)
+	add(t, r, "2", "new", "g1", t0.Add(recentWindow+48*time.Hour))
+	if len(r.recent) != 1 {
+		t.Errorf("%d records in memory, want 1", len(r.recent))
+	}
+
+	tests := []struct {
+		f    Filter
+		want map[string]int
+	}{
+		{Filter{}, map[string]int{"old": 1, "new": 1}},
+		{Filter{Since: t0.Add(-time.Hour)}, map[string]int{"old": 1, "new": 1}},
+		{Filter{Since: t0.Add(time.Hour)}, map[string]int{"new": 1}},
+	}
+	for _, tc := range tests {
+		if got := counts(t, r, tc.f); !maps.Equal(got, tc.want) {
+			t.Errorf("Usages(%+v) = %v, want %v", tc.f, got, tc.want)
+		}
+	}
+
+	// The records are loaded again on reopening.
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.recent) != 1 {
+		t.Errorf("%d records in memory after reopening, want 1", len(r.recent))
+	}
+	for _, tc := range tests {
+		if got := counts(t, r, tc.f); !maps.Equal(got, tc.want) {
+			t.Errorf("after reopening, Usages(%+v) = %v, want %v", tc.f, got, tc.want)
+		}
+	}
+}
+
+func TestOpenSkipsMalformedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	data := `{"sticker_id":"1","sticker":"cat","time":"2024-01-01T00:00:00Z"}
+{"sticker_id":"2","sti
+{"sticker_id":"1","sticker":"cat","time":"2024-01-02T00:00:00Z"}
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, want := counts(t, r, Filter{}), map[string]int{"cat": 2}; !maps.Equal(got, want) {
+		t.Errorf("Usages() = %v, want %v", got, want)
+	}
+}
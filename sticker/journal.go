@@ -0,0 +1,120 @@
+package sticker
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// The kinds of the operations.
+const (
+	OpAdd     = "add"
+	OpAddText = "txt-add"
+	OpRename  = "rename"
+)
+
+// maxJournalSize is the number of the most recent operations kept in the journal.
+const maxJournalSize = 100
+
+// Operation is a mutation of the library recorded in the journal so that it can be undone.
+// OldName is empty for the added stickers.
+type Operation struct {
+	Kind      string
+	Actor     string
+	StickerID string
+	OldName   string
+	NewName   string
+	Time      time.Time
+
+	oldPath     string
+	oldCategory string
+	newPath     string
+	undone      bool
+}
+
+// record appends op to the journal. The journal is kept in memory only.
+func (m *Manager) record(op *Operation) {
+	op.Time = time.Now()
+	m.journal = append(m.journal, op)
+	if len(m.journal) > maxJournalSize {
+		m.journal = slices.Clone(m.journal[len(m.journal)-maxJournalSize:])
+	}
+}
+
+// LastOperation returns the most recent operation done by actor, or nil if there is none.
+func (m *Manager) LastOperation(actor string) *Operation {
+	for i := len(m.journal) - 1; i >= 0; i-- {
+		if m.journal[i].Actor == actor {
+			return m.journal[i]
+		}
+	}
+	return nil
+}
+
+// removeSticker removes s from m.stickers.
+func (m *Manager) removeSticker(s *Sticker) {
+	for i, t := range m.stickers {
+		if t == s {
+			m.stickers = slices.Delete(m.stickers, i, i+1)
+			break
+		}
+	}
+}
+
+// Undo reverts the most recent operation done by actor if it was done within window.
+// Only the most recent operation can be undone, and undoing fails if the sticker has been changed since.
+// The error convention is the same as AddSticker.
+func (m *Manager) Undo(actor string, window time.Duration) (*Operation, error) {
+	op := m.LastOperation(actor)
+	if op == nil || op.undone {
+		return nil, errors.New("Nothing to undo.")
+	}
+	if elapsed := time.Since(op.Time); elapsed > window {
+		return nil, errors.New(fmt.Sprintf("The last change was made %s ago. Only the changes in the last %s can be undone.",
+			elapsed.Round(time.Second), window))
+	}
+	s := m.StickerByID(op.StickerID)
+	if s == nil || s.name != op.NewName || s.path != op.newPath {
+		return nil, errors.New(fmt.Sprintf("Sticker `%s` has been changed since, so the change cannot be undone safely.", op.NewName))
+	}
+
+	switch op.Kind {
+	case OpAdd, OpAddText:
+		if err := os.Remove(s.path); err != nil {
+			log.Println("Failed to remove the sticker:", err)
+			return nil, UninformableErr
+		}
+		m.removeSticker(s)
+	case OpRename:
+		// The old name may be taken while the sticker had the new one.
+		if err := m.checkConflictExcept(op.OldName, s); err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(op.oldPath); err == nil {
+			return nil, errors.New(fmt.Sprintf("Another file has been put at the old place of `%s`, so the change cannot be undone safely.", op.NewName))
+		}
+		if err := os.MkdirAll(filepath.Dir(op.oldPath), 0755); err != nil {
+			log.Println("Failed to create the category directory:", err)
+			return nil, UninformableErr
+		}
+		if err := os.Rename(s.path, op.oldPath); err != nil {
+			log.Println("Failed to move the image back:", err)
+			return nil, UninformableErr
+		}
+		m.removeSticker(s)
+		s.name = op.OldName
+		s.path = op.oldPath
+		s.category = op.oldCategory
+		m.insertSticker(s)
+	default:
+		panic("Should not go here")
+	}
+	m.persistMetadata()
+	op.undone = true
+
+	return op, nil
+}
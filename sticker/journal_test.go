@@ -0,0 +1,122 @@
+package sticker
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUndoAdd(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	s, err := m.AddText("alpha", "words", "hello", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Undo("u2", time.Minute); err == nil {
+		t.Error("another user undid the change")
+	}
+	op, err := m.Undo("u1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.Kind != OpAddText || op.NewName != "words-alpha" {
+		t.Errorf("Undo() = %+v, want the addition of words-alpha", op)
+	}
+	if m.StickerByID(s.ID()) != nil || exists(s.Path()) {
+		t.Error("the added sticker is still there")
+	}
+	if _, err := m.Undo("u1", time.Minute); err == nil {
+		t.Error("the change was undone twice")
+	}
+}
+
+func TestUndoRename(t *testing.T) {
+	tests := []struct {
+		category         string
+		wantName, wantAt string
+	}{
+		{"", "old-bravo", "old/bravo.png"},
+		{"new", "new-bravo", "new/bravo.png"},
+		{RootCategory, "bravo", "bravo.png"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.wantName, func(t *testing.T) {
+			m, root := newTestManager(t, "old/alpha.png")
+
+			s, oldName, err := m.RenameSticker("alpha", "bravo", tc.category, "u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if oldName != "old-alpha" || s.Name() != tc.wantName {
+				t.Fatalf("RenameSticker() = %q, %q; want %s, old-alpha", s.Name(), oldName, tc.wantName)
+			}
+			if want := filepath.Join(root, filepath.FromSlash(tc.wantAt)); s.Path() != want || !exists(want) {
+				t.Errorf("the renamed sticker is at %q, want %q", s.Path(), want)
+			}
+			if _, err := m.Undo("u1", time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			oldPath := filepath.Join(root, "old", "alpha.png")
+			if s.Name() != "old-alpha" || s.Category() != "old" || s.Path() != oldPath {
+				t.Errorf("after undoing, the sticker is %q in %q at %q", s.Name(), s.Category(), s.Path())
+			}
+			if !exists(oldPath) {
+				t.Error("the file is not moved back")
+			}
+		})
+	}
+}
+
+func TestUndoRefused(t *testing.T) {
+	tests := []struct {
+		name string
+		// change makes the change of u1 not undoable.
+		change func(t *testing.T, m *Manager)
+	}{
+		{
+			name: "expired",
+			change: func(t *testing.T, m *Manager) {
+				m.LastOperation("u1").Time = time.Now().Add(-2 * time.Minute)
+			},
+		},
+		{
+			name: "renamed by another user",
+			change: func(t *testing.T, m *Manager) {
+				if _, _, err := m.RenameSticker("bravo", "charlie", "", "u2"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "old name taken",
+			change: func(t *testing.T, m *Manager) {
+				if _, err := m.AddText("alpha", "", "taken", "u2"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _ := newTestManager(t, "alpha.png")
+			if _, _, err := m.RenameSticker("alpha", "bravo", "", "u1"); err != nil {
+				t.Fatal(err)
+			}
+			tc.change(t, m)
+			if _, err := m.Undo("u1", time.Minute); err == nil || err == UninformableErr {
+				t.Errorf("Undo() = %v, want an error for the user", err)
+			}
+		})
+	}
+}
+
+func TestJournalSize(t *testing.T) {
+	m, _ := newTestManager(t)
+	for i := 0; i < maxJournalSize+10; i++ {
+		m.record(&Operation{Kind: OpAddText, Actor: "u1"})
+	}
+	if len(m.journal) != maxJournalSize {
+		t.Errorf("the journal has %d operations, want %d", len(m.journal), maxJournalSize)
+	}
+}
@@ -22,6 +22,11 @@ type Manager struct {
 	root          string
 	stickers      []*Sticker
 	caseSensitive bool
+	metadataPath  string
+	pendingDir    string
+	pending       []*Pending
+	journal       []*Operation
+	diskQuota     int64
 
 	mu sync.RWMutex
 }
@@ -43,6 +48,14 @@ func CaseSensitive(v bool) ManagerOption {
 	}
 }
 
+// MetadataPath sets the file to persist the sticker metadata, e.g. the sticker IDs.
+// Without the file the IDs change on every start.
+func MetadataPath(path string) ManagerOption {
+	return func(m *Manager) {
+		m.metadataPath = path
+	}
+}
+
 func NewManager(root string, opts ...ManagerOption) (*Manager, error) {
 	m := &Manager{root: filepath.Clean(root)}
 	for _, o := range opts {
@@ -51,6 +64,12 @@ func NewManager(root string, opts ...ManagerOption) (*Manager, error) {
 	if err := m.loadStickers(); err != nil {
 		return nil, err
 	}
+	if err := m.loadMetadata(); err != nil {
+		return nil, err
+	}
+	if err := m.loadPending(); err != nil {
+		return nil, err
+	}
 	return m, nil
 }
 
@@ -81,7 +100,8 @@ func (m *Manager) insertSticker(s *Sticker) {
 // loadStickers reads the structure of the stickers in the file system.
 // Under the root directory, this function walks recursively into every directory,
 // and treats all found png, jpeg, and gif files as stickers.
-// The filepath separator in the sticker names will be replaced by '-'.
+// The directories are the categories of the stickers,
+// and the filepath separator in the sticker names will be replaced by '-'.
 func (m *Manager) loadStickers() error {
 	var paths []string
 
@@ -93,9 +113,7 @@ func (m *Manager) loadStickers() error {
 			log.Printf("WalkDir failed, path=%s err=%v\n", path, err)
 			return fs.SkipDir
 		}
-		if d.IsDir() {
-			log.Printf("Directory found, support of directories could be deprecated in the future, path=%s\n", path)
-		} else {
+		if !d.IsDir() {
 			if filepath.Ext(path) == "" {
 				log.Printf("Found a file without extension, skipped, path=%s\n", path)
 			} else {
@@ -114,14 +132,20 @@ func (m *Manager) loadStickers() error {
 		if name[0] == filepath.Separator {
 			name = name[1:]
 		}
+		category := ""
+		if i := strings.LastIndex(filepath.ToSlash(name), "/"); i >= 0 {
+			category = filepath.ToSlash(name)[:i]
+		}
 		name = strings.ReplaceAll(filepath.ToSlash(name), "/", "-")
 		if !m.caseSensitive {
 			name = strings.ToLower(name)
+			category = strings.ToLower(category)
 		}
 
 		stickers[i] = &Sticker{
-			name: name,
-			path: p,
+			name:     name,
+			path:     p,
+			category: category,
 		}
 	}
 
@@ -142,6 +166,69 @@ func (m *Manager) loadStickers() error {
 	return nil
 }
 
+// NormalizeCategory converts the category given by user to the form of Sticker.Category.
+func (m *Manager) NormalizeCategory(category string) string {
+	category = strings.Trim(filepath.ToSlash(category), "/")
+	if !m.caseSensitive {
+		category = strings.ToLower(category)
+	}
+	return category
+}
+
+// InCategory returns the stickers in the category or its sub-categories.
+func (m *Manager) InCategory(stickers []*Sticker, category string) []*Sticker {
+	category = m.NormalizeCategory(category)
+	var ret []*Sticker
+	for _, s := range stickers {
+		if s.category == category || strings.HasPrefix(s.category, category+"/") {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func checkCategory(category string) error {
+	for _, c := range strings.Split(category, "/") {
+		if c == "" || strings.HasPrefix(c, ".") || strings.ContainsRune(c, filepath.Separator) {
+			return errors.New(fmt.Sprintf("Invalid category `%s`. Sub-categories are separated by slashes and must not be empty or start with a dot.", category))
+		}
+	}
+	return nil
+}
+
+// targetOf returns the normalized category, the flattened sticker name and the path without extension
+// of a new sticker named name in category.
+// The directory of an existing category is reused even if the case is different.
+func (m *Manager) targetOf(name, category string) (string, string, string, error) {
+	category = strings.Trim(filepath.ToSlash(category), "/")
+	if category == "" {
+		return "", name, filepath.Join(m.root, name), nil
+	}
+	if err := checkCategory(category); err != nil {
+		return "", "", "", err
+	}
+
+	dir := filepath.Join(m.root, filepath.FromSlash(category))
+	normalized := m.NormalizeCategory(category)
+	for _, s := range m.stickers {
+		if s.category == normalized {
+			dir = filepath.Dir(s.path)
+			break
+		}
+	}
+	return normalized, FlattenedName(name, category), filepath.Join(dir, name), nil
+}
+
+// FlattenedName returns the name of the sticker named name in category,
+// which is the slash separated path with the slashes replaced by '-'.
+func FlattenedName(name, category string) string {
+	category = strings.Trim(filepath.ToSlash(category), "/")
+	if category == "" {
+		return name
+	}
+	return strings.ReplaceAll(category, "/", "-") + "-" + name
+}
+
 // UninformableErr indicates an internal error.
 // Functions should log the info before returning UninformableErr.
 var UninformableErr = errors.New("Error uninformable to user")
@@ -150,53 +237,130 @@ const (
 	AddStickerSizeLimit = 3500000
 )
 
-// AddSticker downloads the sticker to local and updates the sticker data.
+// AddSticker downloads the sticker to local, updates the sticker data and returns the new sticker.
+// The sticker is put in category, or directly under the root if category is empty.
+// actor is the user who adds the sticker, which is recorded in the journal for undoing.
 // UninformableErr is returned when there is an internal error occurs;
 // Otherwise there is probably an error caused by user and the error object may cantain advice if any.
-func (m *Manager) AddSticker(name, url string) (retErr error) {
+func (m *Manager) AddSticker(name, category, url, actor string) (*Sticker, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	category, name, base, err := m.targetOf(name, category)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkConflict(name); err != nil {
+		return nil, err
+	}
+
+	ext, size, err := headImage(url)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkDiskQuota(size); err != nil {
+		return nil, err
+	}
+	body, err := getImage(url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	path := base + "." + ext
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Println("Failed to create the category directory:", err)
+		return nil, UninformableErr
+	}
+	if err := writeFile(path, body); err != nil {
+		return nil, err
+	}
+
+	if !m.caseSensitive {
+		name = strings.ToLower(name)
+	}
+	s := &Sticker{
+		id:       newStickerID(),
+		name:     name,
+		path:     path,
+		category: category,
+		owner:    actor,
+	}
+	m.insertSticker(s)
+	m.persistMetadata()
+	m.record(&Operation{Kind: OpAdd, Actor: actor, StickerID: s.id, NewName: s.name, newPath: s.path})
+
+	return s, nil
+}
+
+func checkName(name string) error {
 	if strings.Contains(filepath.ToSlash(name), "/") {
 		return errors.New(fmt.Sprintf("Invalid sticker name, filepath separator (%c) or slash is included", filepath.Separator))
 	}
+	return nil
+}
+
+// checkConflict checks whether the flattened name conflicts with the existing stickers,
+// i.e. one of the names contains the other one.
+func (m *Manager) checkConflict(name string) error {
+	return m.checkConflictExcept(name, nil)
+}
 
-	if ss := m.MatchedStickers([][]string{{name}}); len(ss) != 0 {
+// checkConflictExcept is checkConflict but ignores except, which is the sticker to be renamed.
+func (m *Manager) checkConflictExcept(name string, except *Sticker) error {
+	isExcept := func(s *Sticker) bool { return s == except }
+	if ss := slices.DeleteFunc(slices.Clone(m.MatchedStickers([][]string{{name}})), isExcept); len(ss) != 0 {
 		matchedStr := StickerListString(ss)
 		return errors.New("The name is contained by the following sticker(s): " + matchedStr)
 	}
-	if ss := m.containedStickers(name); len(ss) != 0 {
+	if ss := slices.DeleteFunc(m.containedStickers(name), isExcept); len(ss) != 0 {
 		matchedStr := StickerListString(ss)
 		return errors.New("The name contains the following sticker(s): " + matchedStr)
 	}
+	return nil
+}
 
+// headImage checks the image at url and returns its extension without the leading dot and its size.
+// The error convention is the same as AddSticker.
+func headImage(url string) (string, int64, error) {
 	resp, err := http.Head(url)
 	if err != nil {
 		log.Printf("Failed to HEAD URL=%q: %v\n", url, err)
-		return errors.New("Failed to download the image. Is it a valid URL?")
+		return "", 0, errors.New("Failed to download the image. Is it a valid URL?")
 	}
 
 	ctype := resp.Header.Get("Content-Type")
 	supportedCtype := []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
 	if !slices.Contains(supportedCtype, ctype) {
-		return errors.New(fmt.Sprintf("Invalid URL content type `%s`. Only `%s` are supported.", ctype, strings.Join(supportedCtype, "`, `")))
+		return "", 0, errors.New(fmt.Sprintf("Invalid URL content type `%s`. Only `%s` are supported.", ctype, strings.Join(supportedCtype, "`, `")))
 	}
 	ext := ctype[len("image/"):]
 
-	size, err := strconv.Atoi(resp.Header.Get("Content-Length"))
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
 	if err != nil {
 		log.Println("Failed to convert the content length to integer:", err)
-		return errors.New("Invalid Content-Length from the URL. Is it a valid URL?")
+		return "", 0, errors.New("Invalid Content-Length from the URL. Is it a valid URL?")
 	}
 	if size > AddStickerSizeLimit {
-		return errors.New(fmt.Sprintf("Image size too large. Expect < %dB, got %d", AddStickerSizeLimit, size))
+		return "", 0, errors.New(fmt.Sprintf("Image size too large. Expect < %dB, got %d", AddStickerSizeLimit, size))
 	}
 
-	resp, err = http.Get(url)
+	return ext, size, nil
+}
+
+// getImage starts downloading the image at url. The error convention is the same as AddSticker.
+func getImage(url string) (io.ReadCloser, error) {
+	resp, err := http.Get(url)
 	if err != nil {
 		log.Printf("Failed to GET URL=%q: %v\n", url, err)
-		return UninformableErr
+		return nil, UninformableErr
 	}
-	defer resp.Body.Close()
+	return resp.Body, nil
+}
 
-	path := filepath.Join(m.root, name+"."+ext)
+// writeFile creates a new file at path with the content of r.
+// The file is removed on failure and UninformableErr is returned.
+func writeFile(path string, r io.Reader) (retErr error) {
 	w, err := os.Create(path)
 	if err != nil {
 		log.Println("Failed to create a new file:", err)
@@ -209,85 +373,105 @@ func (m *Manager) AddSticker(name, url string) (retErr error) {
 	}()
 	defer w.Close()
 
-	if _, err := io.Copy(w, resp.Body); err != nil {
+	if _, err := io.Copy(w, r); err != nil {
 		log.Println("Failed to write the image:", err)
 		return UninformableErr
 	}
-
-	if !m.caseSensitive {
-		name = strings.ToLower(name)
+	if err := w.Close(); err != nil {
+		log.Println("Failed to close the image:", err)
+		return UninformableErr
 	}
-	m.insertSticker(&Sticker{
-		name: name,
-		path: path,
-	})
-
 	return nil
 }
 
 const maxTextLen = 1350
 
-// AddText adds a new plain-text sticker and updates the sticker data.
+// AddText adds a new plain-text sticker, updates the sticker data and returns the new sticker.
+// The sticker is put in category, or directly under the root if category is empty.
+// actor is the user who adds the sticker, which is recorded in the journal for undoing.
 // UninformableErr is returned when there is an internal error occurs;
 // Otherwise there is probably an error caused by user and the error object may cantain advice if any.
-func (m *Manager) AddText(name, text string) (retErr error) {
-	if strings.Contains(filepath.ToSlash(name), "/") {
-		return errors.New(fmt.Sprintf("Invalid sticker name, filepath separator (%c) or slash is included", filepath.Separator))
+func (m *Manager) AddText(name, category, text, actor string) (*Sticker, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
 	}
-
-	if ss := m.MatchedStickers([][]string{{name}}); len(ss) != 0 {
-		matchedStr := StickerListString(ss)
-		return errors.New("The name is contained by the following sticker(s): " + matchedStr)
+	category, name, base, err := m.targetOf(name, category)
+	if err != nil {
+		return nil, err
 	}
-	if ss := m.containedStickers(name); len(ss) != 0 {
-		matchedStr := StickerListString(ss)
-		return errors.New("The name contains the following sticker(s): " + matchedStr)
+	if err := m.checkConflict(name); err != nil {
+		return nil, err
 	}
 
 	if len(text) > maxTextLen {
-		return errors.New(fmt.Sprintf("Maximum text length exceeded: got %d, want <= %d", len(text), maxTextLen))
+		return nil, errors.New(fmt.Sprintf("Maximum text length exceeded: got %d, want <= %d", len(text), maxTextLen))
+	}
+	if err := m.checkDiskQuota(int64(len(text))); err != nil {
+		return nil, err
 	}
 
-	path := filepath.Join(m.root, name+".txt")
+	path := base + ".txt"
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Println("Failed to create the category directory:", err)
+		return nil, UninformableErr
+	}
 	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
 		log.Println("Failed to write file:", err)
 		if err := os.Remove(path); err != nil {
 			log.Println("Failed to remove file:", err)
 		}
-		return UninformableErr
+		return nil, UninformableErr
 	}
 
 	if !m.caseSensitive {
 		name = strings.ToLower(name)
 	}
-	m.insertSticker(&Sticker{
-		name: name,
-		path: path,
-	})
+	s := &Sticker{
+		id:       newStickerID(),
+		name:     name,
+		path:     path,
+		category: category,
+		owner:    actor,
+	}
+	m.insertSticker(s)
+	m.persistMetadata()
+	m.record(&Operation{Kind: OpAddText, Actor: actor, StickerID: s.id, NewName: s.name, newPath: s.path})
 
-	return nil
+	return s, nil
 }
 
-// RenameSticker renames the sticker.
+// RootCategory is the category of RenameSticker moving the sticker directly under the root.
+const RootCategory = "/"
+
+// RenameSticker renames the sticker and moves it to category. It returns the sticker and its old name.
+// If category is empty the sticker stays in its category; RootCategory moves it directly under the root.
+// actor is the user who renames the sticker, which is recorded in the journal for undoing.
 // UninformableErr is returned when there is an internal error occurs;
 // Otherwise there is probably an error caused by user and the error object may cantain advice if any.
-func (m *Manager) RenameSticker(src, dst string) (retErr error) {
+func (m *Manager) RenameSticker(src, dst, category, actor string) (s *Sticker, oldName string, retErr error) {
 	srcMatched := m.MatchedStickers([][]string{{src}})
 	if len(srcMatched) < 1 {
-		return errors.New("Sticker not found.")
+		return nil, "", errors.New("Sticker not found.")
 	}
 	if len(srcMatched) > 1 {
 		matchedStr := StickerListString(srcMatched)
-		return errors.New("Found more than one stickers. Matched: " + matchedStr)
+		return nil, "", errors.New("Found more than one stickers. Matched: " + matchedStr)
 	}
 
 	if strings.Contains(filepath.ToSlash(dst), "/") {
-		return errors.New(fmt.Sprintf("Invalid dst path, filepath separator (%c) or slash is included", filepath.Separator))
+		return nil, "", errors.New(fmt.Sprintf("Invalid dst path, filepath separator (%c) or slash is included", filepath.Separator))
+	}
+	if category == "" {
+		category = srcMatched[0].category
+	}
+	category, dst, base, err := m.targetOf(dst, category)
+	if err != nil {
+		return nil, "", err
 	}
 
 	dstMatched := m.MatchedStickers([][]string{{dst}})
 	if len(dstMatched) > 1 || (len(dstMatched) == 1 && dstMatched[0] != srcMatched[0]) {
-		return errors.New("The new name is contained by existing sticker(s): " + StickerListString(dstMatched))
+		return nil, "", errors.New("The new name is contained by existing sticker(s): " + StickerListString(dstMatched))
 	}
 	if ss := m.containedStickers(dst); len(ss) != 0 {
 		for i, s := range ss {
@@ -299,15 +483,19 @@ func (m *Manager) RenameSticker(src, dst string) (retErr error) {
 		}
 		if len(ss) != 0 {
 			matchedStr := StickerListString(ss)
-			return errors.New("The name contains the following sticker(s): " + matchedStr)
+			return nil, "", errors.New("The name contains the following sticker(s): " + matchedStr)
 		}
 	}
 
 	srcPath := srcMatched[0].Path()
-	dstPath := filepath.Join(m.root, dst+srcMatched[0].Ext())
+	dstPath := base + srcMatched[0].Ext()
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		log.Println("Failed to create the category directory:", err)
+		return nil, "", UninformableErr
+	}
 	if err := os.Rename(srcPath, dstPath); err != nil {
 		log.Println("Failed to move the image:", err)
-		return UninformableErr
+		return nil, "", UninformableErr
 	}
 	defer func() {
 		if retErr != nil {
@@ -320,19 +508,27 @@ func (m *Manager) RenameSticker(src, dst string) (retErr error) {
 	if !m.caseSensitive {
 		dst = strings.ToLower(dst)
 	}
+	op := &Operation{
+		Kind:        OpRename,
+		Actor:       actor,
+		StickerID:   srcMatched[0].id,
+		OldName:     srcMatched[0].name,
+		NewName:     dst,
+		oldPath:     srcPath,
+		oldCategory: srcMatched[0].category,
+		newPath:     dstPath,
+	}
+	oldName = srcMatched[0].name
 	srcMatched[0].name = dst
 	srcMatched[0].path = dstPath
+	srcMatched[0].category = category
 
-	for i, s := range m.stickers {
-		if s == srcMatched[0] {
-			copy(m.stickers[i:], m.stickers[i+1:])
-			m.stickers = m.stickers[:len(m.stickers)-1]
-			break
-		}
-	}
+	m.removeSticker(srcMatched[0])
 	m.insertSticker(srcMatched[0])
+	m.persistMetadata()
+	m.record(op)
 
-	return nil
+	return srcMatched[0], oldName, nil
 }
 
 // MatchedStickers returns the matched stickers.
@@ -381,6 +577,42 @@ func (m *Manager) MatchedStickers(patternGroups [][]string) []*Sticker {
 	return ret
 }
 
+// StickerByID returns the sticker with the ID, or nil if there is no such sticker.
+func (m *Manager) StickerByID(id string) *Sticker {
+	for _, s := range m.stickers {
+		if s.id == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// OwnedBy returns the number of the stickers owned by the user, including the ones waiting for approval.
+func (m *Manager) OwnedBy(userID string) int {
+	n := 0
+	for _, s := range m.stickers {
+		if s.owner == userID {
+			n++
+		}
+	}
+	for _, p := range m.pending {
+		if p.submitter == userID {
+			n++
+		}
+	}
+	return n
+}
+
+// StickerByPath returns the sticker stored at path, or nil if there is no such sticker.
+func (m *Manager) StickerByPath(path string) *Sticker {
+	for _, s := range m.stickers {
+		if s.path == path {
+			return s
+		}
+	}
+	return nil
+}
+
 func (m *Manager) containedStickers(name string) []*Sticker {
 	var ret []*Sticker
 	if !m.caseSensitive {
@@ -0,0 +1,95 @@
+package sticker
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newTestManager creates a manager on a temporary library with the files, which are paths relative to the root.
+func newTestManager(t *testing.T, files ...string) (*Manager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "stickers")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewManager(root,
+		MetadataPath(filepath.Join(dir, "stickers.json")),
+		PendingPath(filepath.Join(dir, "pending")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, root
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func names(ss []*Sticker) []string {
+	ret := make([]string, len(ss))
+	for i, s := range ss {
+		ret[i] = s.Name()
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+func TestCategories(t *testing.T) {
+	m, root := newTestManager(t, "top.txt", "Animals/cat.txt", "animals/wild/wolf.txt")
+
+	if _, err := m.AddText("dog", "/ANIMALS/", "woof", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	// The directory of the existing category is reused regardless of the case.
+	if path := filepath.Join(root, "Animals", "dog.txt"); !exists(path) {
+		t.Errorf("the sticker is not added at %q", path)
+	}
+
+	tests := []struct {
+		category string
+		want     []string
+	}{
+		{"animals", []string{"animals-cat", "animals-dog", "animals-wild-wolf"}},
+		{"Animals/Wild", []string{"animals-wild-wolf"}},
+		{"anim", nil},
+	}
+	for _, tc := range tests {
+		if got := names(m.InCategory(m.Stickers(), tc.category)); !slices.Equal(got, tc.want) {
+			t.Errorf("InCategory(%q) = %v, want %v", tc.category, got, tc.want)
+		}
+	}
+
+	for _, category := range []string{"a//b", ".hidden", "a/.b"} {
+		if _, err := m.AddText("x", category, "x", "u1"); err == nil || err == UninformableErr {
+			t.Errorf("AddText() in category %q = %v, want an error for the user", category, err)
+		}
+	}
+}
+
+func TestRenameStickerCategory(t *testing.T) {
+	m, root := newTestManager(t, "animals/cat.txt")
+
+	if _, _, err := m.RenameSticker("animals-cat", "kitty", "pets", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	ss := m.MatchedStickers([][]string{{"pets-kitty"}})
+	if len(ss) != 1 || ss[0].Category() != "pets" {
+		t.Fatalf("the renamed sticker is not found in the category: %v", names(ss))
+	}
+	if want := filepath.Join(root, "pets", "kitty.txt"); ss[0].Path() != want || !exists(want) {
+		t.Errorf("the renamed sticker is at %q, want %q", ss[0].Path(), want)
+	}
+}
@@ -0,0 +1,118 @@
+package sticker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// metadata is the info of a sticker which cannot be derived from the file system.
+type metadata struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner,omitempty"`
+	NSFW  bool   `json:"nsfw,omitempty"`
+}
+
+func newStickerID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// relPath returns the path of s relative to the root, which is the key of the metadata.
+func (m *Manager) relPath(s *Sticker) string {
+	rel, err := filepath.Rel(m.root, s.path)
+	if err != nil {
+		return s.path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// loadMetadata reads the metadata file and fills the metadata into m.stickers.
+// Stickers without metadata get new IDs, and the file is rewritten if anything changes.
+func (m *Manager) loadMetadata() error {
+	if m.metadataPath == "" {
+		for _, s := range m.stickers {
+			s.id = newStickerID()
+		}
+		return nil
+	}
+
+	saved := make(map[string]metadata)
+	b, err := os.ReadFile(m.metadataPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &saved); err != nil {
+			return err
+		}
+	}
+
+	dirty := len(saved) != len(m.stickers)
+	for _, s := range m.stickers {
+		if md, ok := saved[m.relPath(s)]; ok && md.ID != "" {
+			s.id = md.ID
+			s.owner = md.Owner
+			s.nsfw = md.NSFW
+		} else {
+			s.id = newStickerID()
+			dirty = true
+		}
+	}
+	if dirty {
+		return m.saveMetadata()
+	}
+	return nil
+}
+
+// saveMetadata writes the metadata of all stickers to the metadata file.
+// The file is replaced atomically so that a crash never leaves a partial file.
+func (m *Manager) saveMetadata() error {
+	if m.metadataPath == "" {
+		return nil
+	}
+
+	saved := make(map[string]metadata)
+	for _, s := range m.stickers {
+		saved[m.relPath(s)] = metadata{ID: s.id, Owner: s.owner, NSFW: s.nsfw}
+	}
+	b, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.metadataPath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.metadataPath)
+}
+
+// SetNSFW sets the NSFW flag of the sticker.
+// UninformableErr is returned if the flag cannot be saved, in which case the flag is left unchanged.
+func (m *Manager) SetNSFW(s *Sticker, nsfw bool) error {
+	old := s.nsfw
+	s.nsfw = nsfw
+	if err := m.saveMetadata(); err != nil {
+		log.Println("Failed to save the sticker metadata:", err)
+		s.nsfw = old
+		return UninformableErr
+	}
+	return nil
+}
+
+// persistMetadata saves the metadata after a successful mutation.
+// The mutation is already done on the file system, so a failure is only logged;
+// The metadata will be written again on the next mutation.
+func (m *Manager) persistMetadata() {
+	if err := m.saveMetadata(); err != nil {
+		log.Println("Failed to save the sticker metadata:", err)
+	}
+}
@@ -0,0 +1,374 @@
+package sticker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Pending is a sticker waiting for approval.
+// It's stored in the pending directory instead of the root, so it's not visible until approved.
+type Pending struct {
+	id        string
+	name      string
+	category  string
+	path      string
+	submitter string
+}
+
+// ID returns the ID of the pending sticker, which becomes the sticker ID once approved.
+func (p *Pending) ID() string {
+	return p.id
+}
+
+// Name returns the flattened name the sticker will get once approved.
+func (p *Pending) Name() string {
+	return FlattenedName(p.name, p.category)
+}
+
+func (p *Pending) Path() string {
+	return p.path
+}
+
+func (p *Pending) Ext() string {
+	return filepath.Ext(p.path)
+}
+
+// Submitter returns the ID of the user who submitted the sticker.
+func (p *Pending) Submitter() string {
+	return p.submitter
+}
+
+// pendingMetadata is the persisted form of Pending. File is relative to the pending directory.
+type pendingMetadata struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Category  string `json:"category"`
+	File      string `json:"file"`
+	Submitter string `json:"submitter"`
+}
+
+// PendingPath sets the directory to keep the stickers waiting for approval.
+// Without the directory the approval queue is disabled.
+func PendingPath(dir string) ManagerOption {
+	return func(m *Manager) {
+		m.pendingDir = dir
+	}
+}
+
+func (m *Manager) pendingIndexPath() string {
+	return filepath.Join(m.pendingDir, "pending.json")
+}
+
+// loadPending reads the index of the pending stickers.
+// The entries whose files are gone are dropped.
+func (m *Manager) loadPending() error {
+	if m.pendingDir == "" {
+		return nil
+	}
+	b, err := os.ReadFile(m.pendingIndexPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved []pendingMetadata
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return err
+	}
+	for _, md := range saved {
+		path := filepath.Join(m.pendingDir, md.File)
+		if _, err := os.Stat(path); err != nil {
+			log.Printf("Dropped a pending sticker, path=%s err=%v\n", path, err)
+			continue
+		}
+		m.pending = append(m.pending, &Pending{
+			id:        md.ID,
+			name:      md.Name,
+			category:  md.Category,
+			path:      path,
+			submitter: md.Submitter,
+		})
+	}
+	return nil
+}
+
+// savePending writes the index of the pending stickers atomically.
+func (m *Manager) savePending() error {
+	saved := make([]pendingMetadata, len(m.pending))
+	for i, p := range m.pending {
+		saved[i] = pendingMetadata{
+			ID:        p.id,
+			Name:      p.name,
+			Category:  p.category,
+			File:      filepath.Base(p.path),
+			Submitter: p.submitter,
+		}
+	}
+	b, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.pendingIndexPath() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.pendingIndexPath())
+}
+
+// PendingStickers returns the stickers waiting for approval, the oldest first.
+func (m *Manager) PendingStickers() []*Pending {
+	return m.pending
+}
+
+// PendingByID returns the pending sticker with the ID, or nil if there is no such sticker.
+func (m *Manager) PendingByID(id string) *Pending {
+	for _, p := range m.pending {
+		if p.id == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// checkSubmission runs the checks of adding the sticker against both the live and the pending stickers.
+// It returns the trimmed category.
+func (m *Manager) checkSubmission(name, category string) (string, error) {
+	if m.pendingDir == "" {
+		log.Println("Tried to submit a sticker while the approval queue is disabled")
+		return "", UninformableErr
+	}
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	_, flattened, _, err := m.targetOf(name, category)
+	if err != nil {
+		return "", err
+	}
+	if err := m.checkConflict(flattened); err != nil {
+		return "", err
+	}
+	for _, p := range m.pending {
+		if p.Name() == flattened || (!m.caseSensitive && strings.EqualFold(p.Name(), flattened)) {
+			return "", errors.New(fmt.Sprintf("Sticker `%s` is already waiting for approval.", p.Name()))
+		}
+	}
+	return strings.Trim(filepath.ToSlash(category), "/"), nil
+}
+
+// addPending records a pending sticker whose file is created by write at the given path.
+// ext has no leading dot.
+func (m *Manager) addPending(name, category, ext, submitter string, write func(path string) error) (*Pending, error) {
+	if err := os.MkdirAll(m.pendingDir, 0755); err != nil {
+		log.Println("Failed to create the pending directory:", err)
+		return nil, UninformableErr
+	}
+	id := newStickerID()
+	p := &Pending{
+		id:        id,
+		name:      name,
+		category:  category,
+		path:      filepath.Join(m.pendingDir, id+"."+ext),
+		submitter: submitter,
+	}
+	if err := write(p.path); err != nil {
+		return nil, err
+	}
+	m.pending = append(m.pending, p)
+	if err := m.savePending(); err != nil {
+		log.Println("Failed to save the pending stickers:", err)
+		m.pending = m.pending[:len(m.pending)-1]
+		os.Remove(p.path)
+		return nil, UninformableErr
+	}
+	return p, nil
+}
+
+// Download is an image downloaded ahead of submitting it,
+// so that the download doesn't hold the lock of the manager.
+type Download struct {
+	path string
+	// ext has no leading dot.
+	ext  string
+	size int64
+}
+
+// Close removes the downloaded file. It's a no-op once the image is submitted.
+func (d *Download) Close() error {
+	if d.path == "" {
+		return nil
+	}
+	err := os.Remove(d.path)
+	d.path = ""
+	return err
+}
+
+// DownloadImage downloads the image at url to a temporary file in the pending directory.
+// Unlike the other methods, it doesn't need the lock of the manager.
+// The caller must close the download unless it's submitted.
+// The error convention is the same as AddSticker.
+func (m *Manager) DownloadImage(url string) (*Download, error) {
+	if m.pendingDir == "" {
+		log.Println("Tried to download a submission while the approval queue is disabled")
+		return nil, UninformableErr
+	}
+	ext, _, err := headImage(url)
+	if err != nil {
+		return nil, err
+	}
+	body, err := getImage(url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(m.pendingDir, 0755); err != nil {
+		log.Println("Failed to create the pending directory:", err)
+		return nil, UninformableErr
+	}
+	f, err := os.CreateTemp(m.pendingDir, "download-*."+ext)
+	if err != nil {
+		log.Println("Failed to create a temporary file:", err)
+		return nil, UninformableErr
+	}
+	f.Close()
+	d := &Download{path: f.Name(), ext: ext}
+	if err := writeFile(d.path, body); err != nil {
+		return nil, err
+	}
+	d.size = fileSize(d.path)
+	return d, nil
+}
+
+// SubmitSticker is AddSticker but the sticker waits for approval instead of going live.
+// The image is taken from d, which is downloaded by DownloadImage.
+// The error convention is the same as AddSticker.
+func (m *Manager) SubmitSticker(name, category string, d *Download, submitter string) (*Pending, error) {
+	category, err := m.checkSubmission(name, category)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkDiskQuota(d.size); err != nil {
+		return nil, err
+	}
+	return m.addPending(name, category, d.ext, submitter, func(path string) error {
+		if err := moveFile(d.path, path); err != nil {
+			return err
+		}
+		d.path = ""
+		return nil
+	})
+}
+
+// SubmitText is AddText but the sticker waits for approval instead of going live.
+// The error convention is the same as AddText.
+func (m *Manager) SubmitText(name, category, text, submitter string) (*Pending, error) {
+	category, err := m.checkSubmission(name, category)
+	if err != nil {
+		return nil, err
+	}
+	if len(text) > maxTextLen {
+		return nil, errors.New(fmt.Sprintf("Maximum text length exceeded: got %d, want <= %d", len(text), maxTextLen))
+	}
+	if err := m.checkDiskQuota(int64(len(text))); err != nil {
+		return nil, err
+	}
+	return m.addPending(name, category, "txt", submitter, func(path string) error {
+		return writeFile(path, strings.NewReader(text))
+	})
+}
+
+func (m *Manager) removePending(p *Pending) {
+	for i, q := range m.pending {
+		if q == p {
+			m.pending = append(m.pending[:i:i], m.pending[i+1:]...)
+			break
+		}
+	}
+	if err := m.savePending(); err != nil {
+		log.Println("Failed to save the pending stickers:", err)
+	}
+}
+
+// ApproveSticker moves the pending sticker into the library.
+// The checks of adding a sticker run again since the library may have changed while the sticker was waiting.
+// The error convention is the same as AddSticker.
+func (m *Manager) ApproveSticker(id string) (*Sticker, error) {
+	p := m.PendingByID(id)
+	if p == nil {
+		return nil, errors.New("The sticker is no longer waiting for approval.")
+	}
+	category, name, base, err := m.targetOf(p.name, p.category)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkConflict(name); err != nil {
+		return nil, err
+	}
+
+	path := base + p.Ext()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Println("Failed to create the category directory:", err)
+		return nil, UninformableErr
+	}
+	if err := moveFile(p.path, path); err != nil {
+		return nil, err
+	}
+
+	if !m.caseSensitive {
+		name = strings.ToLower(name)
+	}
+	s := &Sticker{
+		id:       p.id,
+		name:     name,
+		path:     path,
+		category: category,
+		owner:    p.submitter,
+	}
+	m.insertSticker(s)
+	m.persistMetadata()
+	m.removePending(p)
+
+	return s, nil
+}
+
+// RejectSticker drops the pending sticker.
+// The error convention is the same as AddSticker.
+func (m *Manager) RejectSticker(id string) (*Pending, error) {
+	p := m.PendingByID(id)
+	if p == nil {
+		return nil, errors.New("The sticker is no longer waiting for approval.")
+	}
+	if err := os.Remove(p.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Println("Failed to remove the pending sticker:", err)
+		return nil, UninformableErr
+	}
+	m.removePending(p)
+	return p, nil
+}
+
+// moveFile renames src to dst, or copies it when they are on different file systems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		log.Println("Failed to open the pending sticker:", err)
+		return UninformableErr
+	}
+	defer r.Close()
+	if err := writeFile(dst, r); err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		log.Println("Failed to remove the pending sticker:", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package sticker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestApproveSticker(t *testing.T) {
+	m, root := newTestManager(t)
+
+	p, err := m.SubmitText("alpha", "words", "hello", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name() != "words-alpha" || len(m.PendingStickers()) != 1 {
+		t.Fatalf("SubmitText() = %q with %d pending, want words-alpha with 1 pending", p.Name(), len(m.PendingStickers()))
+	}
+	if len(m.Stickers()) != 0 {
+		t.Error("the pending sticker is visible before approval")
+	}
+	if _, err := m.SubmitText("alpha", "words", "again", "u2"); err == nil {
+		t.Error("the same name was submitted twice")
+	}
+
+	s, err := m.ApproveSticker(p.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ID() != p.ID() || s.Name() != "words-alpha" || s.Owner() != "u1" {
+		t.Errorf("ApproveSticker() = %q (%s) owned by %q, want words-alpha (%s) owned by u1", s.Name(), s.ID(), s.Owner(), p.ID())
+	}
+	if want := filepath.Join(root, "words", "alpha.txt"); s.Path() != want || !exists(want) {
+		t.Errorf("the approved sticker is at %q, want %q", s.Path(), want)
+	}
+	if exists(p.Path()) || len(m.PendingStickers()) != 0 {
+		t.Error("the approved sticker is still pending")
+	}
+	if _, err := m.ApproveSticker(p.ID()); err == nil {
+		t.Error("the sticker was approved twice")
+	}
+}
+
+func TestApproveStickerConflict(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	p, err := m.SubmitText("alpha", "", "hello", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The library changes while the sticker is waiting.
+	if _, err := m.AddText("alphabet", "", "taken", "u2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ApproveSticker(p.ID()); err == nil || err == UninformableErr {
+		t.Errorf("ApproveSticker() = %v, want an error for the user", err)
+	}
+	if m.PendingByID(p.ID()) == nil || !exists(p.Path()) {
+		t.Error("the refused sticker is no longer pending")
+	}
+}
+
+func TestRejectSticker(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	p, err := m.SubmitText("alpha", "", "hello", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.RejectSticker(p.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if exists(p.Path()) || len(m.PendingStickers()) != 0 || len(m.Stickers()) != 0 {
+		t.Error("the rejected sticker is left")
+	}
+	if _, err := m.SubmitText("alpha", "", "again", "u1"); err != nil {
+		t.Errorf("the name of the rejected sticker cannot be submitted again: %v", err)
+	}
+}
+
+func TestPendingReloaded(t *testing.T) {
+	m, root := newTestManager(t)
+
+	p, err := m.SubmitText("alpha", "", "hello", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewManager(root, PendingPath(m.pendingDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := reloaded.PendingByID(p.ID())
+	if q == nil || q.Name() != p.Name() || q.Submitter() != "u1" || q.Path() != p.Path() {
+		t.Errorf("the reloaded pending sticker is %+v, want %+v", q, p)
+	}
+}
+
+func TestSubmitWithoutQueue(t *testing.T) {
+	m, err := NewManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.SubmitText("alpha", "", "hello", "u1"); err != UninformableErr {
+		t.Errorf("SubmitText() = %v, want UninformableErr", err)
+	}
+}
+
+func TestSubmitDownload(t *testing.T) {
+	image := []byte("not really a png")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+		w.Write(image)
+	}))
+	defer srv.Close()
+	m, _ := newTestManager(t)
+
+	d, err := m.DownloadImage(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := d.path
+	p, err := m.SubmitSticker("alpha", "", d, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(p.Path()); err != nil || string(b) != string(image) || p.Ext() != ".png" {
+		t.Errorf("the pending sticker at %q has %q (%v), want the downloaded png", p.Path(), b, err)
+	}
+	if err := d.Close(); err != nil || exists(tmp) {
+		t.Errorf("Close() of the submitted download = %v, want a no-op leaving no temporary file", err)
+	}
+
+	// A download refused by the checks is removed on Close.
+	d, err = m.DownloadImage(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp = d.path
+	if _, err := m.SubmitSticker("alpha", "", d, "u2"); err == nil {
+		t.Error("the same name was submitted twice")
+	}
+	if err := d.Close(); err != nil || exists(tmp) {
+		t.Errorf("Close() = %v, want the temporary file removed", err)
+	}
+}
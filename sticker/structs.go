@@ -5,14 +5,40 @@ import (
 )
 
 type Sticker struct {
-	name string
-	path string
+	id       string
+	name     string
+	path     string
+	category string
+	owner    string
+	nsfw     bool
+}
+
+// ID returns the stable identity of the sticker, which is kept across renames.
+func (s *Sticker) ID() string {
+	return s.id
 }
 
 func (s *Sticker) Name() string {
 	return s.name
 }
 
+// Category returns the directory of the sticker relative to the root, separated by slashes.
+// It's empty for the stickers directly under the root.
+func (s *Sticker) Category() string {
+	return s.category
+}
+
+// Owner returns the ID of the user who added the sticker.
+// It's empty for the stickers added before the owners were recorded, or put in the root directly.
+func (s *Sticker) Owner() string {
+	return s.owner
+}
+
+// NSFW reports whether the sticker can only be posted in age-restricted channels.
+func (s *Sticker) NSFW() bool {
+	return s.nsfw
+}
+
 func (s *Sticker) Path() string {
 	return s.path
 }
@@ -0,0 +1,83 @@
+package sticker
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DiskQuota sets the maximum total size in bytes of the sticker files, including the ones waiting for approval.
+// 0 means no limit.
+func DiskQuota(bytes int64) ManagerOption {
+	return func(m *Manager) {
+		m.diskQuota = bytes
+	}
+}
+
+// StickerSize is a sticker with the size of its file.
+type StickerSize struct {
+	Sticker *Sticker
+	Size    int64
+}
+
+// DiskUsage is the disk space taken by the library.
+type DiskUsage struct {
+	// Counts is the number of the stickers by the extension without the leading dot.
+	// "jpg" is counted as "jpeg".
+	Counts map[string]int
+	// Bytes is the total size, including PendingBytes.
+	Bytes        int64
+	PendingBytes int64
+	// Quota is the disk quota, or 0 if there is no limit.
+	Quota int64
+	// Largest are the largest stickers, the largest first.
+	Largest []StickerSize
+}
+
+func fileSize(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		log.Println("Failed to stat the sticker:", err)
+		return 0
+	}
+	return fi.Size()
+}
+
+// DiskUsage returns the disk usage with at most largest stickers in DiskUsage.Largest.
+func (m *Manager) DiskUsage(largest int) DiskUsage {
+	u := DiskUsage{Counts: make(map[string]int), Quota: m.diskQuota}
+	sizes := make([]StickerSize, len(m.stickers))
+	for i, s := range m.stickers {
+		ext := strings.ToLower(strings.TrimPrefix(s.Ext(), "."))
+		if ext == "jpg" {
+			ext = "jpeg"
+		}
+		u.Counts[ext]++
+		sizes[i] = StickerSize{Sticker: s, Size: fileSize(s.path)}
+		u.Bytes += sizes[i].Size
+	}
+	for _, p := range m.pending {
+		u.PendingBytes += fileSize(p.path)
+	}
+	u.Bytes += u.PendingBytes
+
+	sort.SliceStable(sizes, func(i, j int) bool { return sizes[i].Size > sizes[j].Size })
+	u.Largest = sizes[:min(largest, len(sizes))]
+	return u
+}
+
+// checkDiskQuota checks whether a new file of size bytes fits in the disk quota.
+func (m *Manager) checkDiskQuota(size int64) error {
+	if m.diskQuota == 0 {
+		return nil
+	}
+	used := m.DiskUsage(0).Bytes
+	if used+size > m.diskQuota {
+		return errors.New(fmt.Sprintf("The sticker library is full: %d of %d bytes are used, and the sticker needs %d bytes. Please contact the admin.",
+			used, m.diskQuota, size))
+	}
+	return nil
+}
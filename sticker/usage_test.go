@@ -0,0 +1,40 @@
+package sticker
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestDiskUsage(t *testing.T) {
+	// The content of every file is its path, so the sizes are the lengths of the paths.
+	m, _ := newTestManager(t, "a.png", "b.jpg", "cats/c.jpeg", "cats/long.gif")
+	if _, err := m.SubmitText("d", "", "pending", "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	u := m.DiskUsage(2)
+	if want := map[string]int{"png": 1, "jpeg": 2, "gif": 1}; !maps.Equal(u.Counts, want) {
+		t.Errorf("Counts = %v, want %v", u.Counts, want)
+	}
+	if u.PendingBytes != 7 || u.Bytes != 5+5+11+13+7 {
+		t.Errorf("Bytes = %d with %d pending, want %d with 7 pending", u.Bytes, u.PendingBytes, 5+5+11+13+7)
+	}
+	if len(u.Largest) != 2 || u.Largest[0].Sticker.Name() != "cats-long" || u.Largest[1].Sticker.Name() != "cats-c" {
+		t.Errorf("Largest = %v, want cats-long and cats-c", u.Largest)
+	}
+}
+
+func TestDiskQuota(t *testing.T) {
+	m, _ := newTestManager(t, "a.png")
+	m.diskQuota = 10
+
+	if _, err := m.AddText("b", "", "12345", "u1"); err != nil {
+		t.Errorf("AddText() within the quota failed: %v", err)
+	}
+	if _, err := m.AddText("c", "", "x", "u1"); err == nil || err == UninformableErr {
+		t.Errorf("AddText() beyond the quota = %v, want an error for the user", err)
+	}
+	if _, err := m.SubmitText("c", "", "x", "u1"); err == nil || err == UninformableErr {
+		t.Errorf("SubmitText() beyond the quota = %v, want an error for the user", err)
+	}
+}
@@ -0,0 +1,109 @@
+package userdata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"slices"
+	"sync"
+)
+
+// UninformableErr indicates an internal error.
+// Functions should log the info before returning UninformableErr.
+var UninformableErr = errors.New("Error uninformable to user")
+
+// MaxFavorites is the maximum number of favorites of a user.
+const MaxFavorites = 50
+
+// Favorites holds the favorite stickers of the users.
+// The stickers are referred by their IDs so that the favorites follow renames.
+// Every change is written to the file immediately.
+type Favorites struct {
+	mu    sync.Mutex
+	path  string
+	lists map[string][]string
+}
+
+// OpenFavorites loads the favorites in path. The file is created on the first change.
+func OpenFavorites(path string) (*Favorites, error) {
+	f := &Favorites{path: path, lists: make(map[string][]string)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &f.lists); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// List returns the sticker IDs in the favorites of the user, in the order they were added.
+func (f *Favorites) List(userID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.lists[userID])
+}
+
+// Add appends the sticker to the favorites of the user.
+// UninformableErr is returned when there is an internal error occurs;
+// Otherwise the error is caused by user.
+func (f *Favorites) Add(userID, stickerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	l := f.lists[userID]
+	if slices.Contains(l, stickerID) {
+		return errors.New("The sticker is already in your favorites.")
+	}
+	if len(l) >= MaxFavorites {
+		return fmt.Errorf("You can have at most %d favorites.", MaxFavorites)
+	}
+	f.lists[userID] = append(l, stickerID)
+	if err := f.save(); err != nil {
+		log.Println("Failed to save the favorites:", err)
+		f.lists[userID] = l
+		return UninformableErr
+	}
+	return nil
+}
+
+// Remove removes the sticker from the favorites of the user.
+// The error convention is the same as Add.
+func (f *Favorites) Remove(userID, stickerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	l := f.lists[userID]
+	i := slices.Index(l, stickerID)
+	if i < 0 {
+		return errors.New("The sticker is not in your favorites.")
+	}
+	f.lists[userID] = slices.Delete(slices.Clone(l), i, i+1)
+	if len(f.lists[userID]) == 0 {
+		delete(f.lists, userID)
+	}
+	if err := f.save(); err != nil {
+		log.Println("Failed to save the favorites:", err)
+		f.lists[userID] = l
+		return UninformableErr
+	}
+	return nil
+}
+
+func (f *Favorites) save() error {
+	b, err := json.MarshalIndent(f.lists, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
@@ -0,0 +1,59 @@
+package userdata
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFavorites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "favorites.json")
+	f, err := OpenFavorites(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := f.Add("u1", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Add("u1", "b"); err == nil || err == UninformableErr {
+		t.Errorf("adding a favorite twice = %v, want an error for the user", err)
+	}
+	if err := f.Remove("u1", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Remove("u1", "b"); err == nil || err == UninformableErr {
+		t.Errorf("removing a missing favorite = %v, want an error for the user", err)
+	}
+	if got, want := f.List("u1"), []string{"a", "c"}; !slices.Equal(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+
+	reloaded, err := OpenFavorites(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reloaded.List("u1"), []string{"a", "c"}; !slices.Equal(got, want) {
+		t.Errorf("after reloading, List() = %v, want %v", got, want)
+	}
+	if got := reloaded.List("u2"); len(got) != 0 {
+		t.Errorf("List() of another user = %v, want none", got)
+	}
+}
+
+func TestFavoritesLimit(t *testing.T) {
+	f, err := OpenFavorites(filepath.Join(t.TempDir(), "favorites.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < MaxFavorites; i++ {
+		if err := f.Add("u1", string(rune('A'+i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Add("u1", "extra"); err == nil {
+		t.Error("adding more than MaxFavorites favorites succeeded")
+	}
+}
@@ -0,0 +1,109 @@
+package userdata
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// recentSaveDelay is how long a persisted history waits after a push before saving,
+// so that a burst of posts is written once.
+const recentSaveDelay = 10 * time.Second
+
+// Recent keeps the stickers most recently posted by every user in memory.
+// A sticker posted again is moved to the front instead of being duplicated.
+type Recent struct {
+	mu    sync.Mutex
+	size  int
+	path  string
+	lists map[string][]string
+	// saveDelay is recentSaveDelay, which can be shortened in tests.
+	saveDelay time.Duration
+	// saving is the pending save scheduled by Push, or nil.
+	saving *time.Timer
+}
+
+// NewRecent creates a history keeping at most size stickers per user.
+// If path is not empty, the history is loaded from path, and saved shortly after every push.
+// Save should still be called on exit to write the pending changes.
+func NewRecent(size int, path string) (*Recent, error) {
+	r := &Recent{size: size, path: path, lists: make(map[string][]string), saveDelay: recentSaveDelay}
+	if path == "" {
+		return r, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &r.lists); err != nil {
+		return nil, err
+	}
+	for u, l := range r.lists {
+		if len(l) > size {
+			r.lists[u] = l[:size]
+		}
+	}
+	return r, nil
+}
+
+// Push records that the user posted the sticker.
+func (r *Recent) Push(userID, stickerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l := slices.DeleteFunc(slices.Clone(r.lists[userID]), func(id string) bool { return id == stickerID })
+	l = slices.Insert(l, 0, stickerID)
+	if len(l) > r.size {
+		l = l[:r.size]
+	}
+	r.lists[userID] = l
+
+	if r.path != "" && r.saving == nil {
+		r.saving = time.AfterFunc(r.saveDelay, func() {
+			if err := r.Save(); err != nil {
+				log.Println("Failed to save the recent history:", err)
+			}
+		})
+	}
+}
+
+// List returns the sticker IDs recently posted by the user, the most recent first.
+func (r *Recent) List(userID string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.lists[userID])
+}
+
+// Save writes the history to the file, including the changes waiting for the delayed save.
+// It's a no-op if the history is not persisted.
+func (r *Recent) Save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.saving != nil {
+		r.saving.Stop()
+		r.saving = nil
+	}
+
+	b, err := json.Marshal(r.lists)
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,73 @@
+package userdata
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRecent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recent.json")
+	r, err := NewRecent(3, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c", "b", "d"} {
+		r.Push("u1", id)
+	}
+	if got, want := r.List("u1"), []string{"d", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+	if err := r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A smaller size trims the saved history.
+	reloaded, err := NewRecent(2, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reloaded.List("u1"), []string{"d", "b"}; !slices.Equal(got, want) {
+		t.Errorf("after reloading, List() = %v, want %v", got, want)
+	}
+}
+
+func TestRecentNotPersisted(t *testing.T) {
+	r, err := NewRecent(3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Push("u1", "a")
+	if err := r.Save(); err != nil {
+		t.Errorf("Save() = %v, want a no-op", err)
+	}
+}
+
+func TestRecentSavedAfterPush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recent.json")
+	r, err := NewRecent(3, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.saveDelay = time.Millisecond
+	r.Push("u1", "a")
+
+	// The history is written without Save, so that it survives a crash.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the history is not saved after a push")
+		}
+	}
+	reloaded, err := NewRecent(3, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reloaded.List("u1"), []string{"a"}; !slices.Equal(got, want) {
+		t.Errorf("after reloading, List() = %v, want %v", got, want)
+	}
+}
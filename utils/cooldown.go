@@ -5,42 +5,104 @@ import (
 	"time"
 )
 
+// CoolDownCounter tracks the items cooling down.
+// Every item has a timer removing it on expiry, which is stopped when the item is removed earlier.
+// The expiry is also checked on every call, so a late timer never extends a cooldown.
 type CoolDownCounter struct {
-	mu    sync.Mutex
-	items map[interface{}]bool
+	mu     sync.Mutex
+	clock  Clock
+	items  map[interface{}]*coolDownItem
+	closed bool
+}
+
+type coolDownItem struct {
+	expiry time.Time
+	timer  Timer
 }
 
 func NewCoolDownCounter() *CoolDownCounter {
+	return NewCoolDownCounterWithClock(RealClock{})
+}
+
+// NewCoolDownCounterWithClock creates a counter on clock, e.g. a fake one for deterministic tests.
+func NewCoolDownCounterWithClock(clock Clock) *CoolDownCounter {
 	return &CoolDownCounter{
-		items: make(map[interface{}]bool),
+		clock: clock,
+		items: make(map[interface{}]*coolDownItem),
 	}
 }
 
 // CoolDown marks item as cooling down.
 // If item is already cooling down, the function is a no-op and returns false;
 // Otherwise the function returns true.
+// After Close, no item can cool down anymore and the function always returns false.
 func (c *CoolDownCounter) CoolDown(d time.Duration, item interface{}) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.items[item] {
+	if c.closed {
 		return false
 	}
+	now := c.clock.Now()
+	if it, ok := c.items[item]; ok {
+		if now.Before(it.expiry) {
+			return false
+		}
+		// The timer is about to fire but hasn't taken the lock yet.
+		c.remove(item, it)
+	}
 
-	c.items[item] = true
-	go func() {
-		time.Sleep(d)
-		c.RemoveCoolDown(item)
-	}()
+	it := &coolDownItem{expiry: now.Add(d)}
+	it.timer = c.clock.AfterFunc(d, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// The item may have been removed and cooled down again in the meantime.
+		if c.items[item] == it {
+			delete(c.items, item)
+		}
+	})
+	c.items[item] = it
 
 	return true
 }
 
+// Remaining returns how long item is still cooling down, or 0 if it's not.
+func (c *CoolDownCounter) Remaining(item interface{}) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	it, ok := c.items[item]
+	if !ok {
+		return 0
+	}
+	return max(it.expiry.Sub(c.clock.Now()), 0)
+}
+
 // RemoveCoolDown removes item from the cooling down list.
-// If item is already cooling down, the function is a no-op.
+// If item is not cooling down, the function is a no-op.
 func (c *CoolDownCounter) RemoveCoolDown(item interface{}) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if it, ok := c.items[item]; ok {
+		c.remove(item, it)
+	}
+}
+
+// remove deletes it and stops its timer. The caller must hold c.mu.
+func (c *CoolDownCounter) remove(item interface{}, it *coolDownItem) {
+	it.timer.Stop()
 	delete(c.items, item)
 }
+
+// Close stops all timers and drops all items.
+// Afterwards CoolDown refuses every item and Remaining always returns 0.
+func (c *CoolDownCounter) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for item, it := range c.items {
+		c.remove(item, it)
+	}
+}
@@ -0,0 +1,106 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"discordsticker/internal/clocktest"
+	"discordsticker/utils"
+)
+
+func newTestCounter() (*utils.CoolDownCounter, *clocktest.Clock) {
+	clock := clocktest.NewClock(time.Unix(0, 0))
+	return utils.NewCoolDownCounterWithClock(clock), clock
+}
+
+func TestCoolDown(t *testing.T) {
+	c, clock := newTestCounter()
+
+	if !c.CoolDown(5*time.Second, "a") {
+		t.Fatal("first CoolDown of a returned false")
+	}
+	if c.CoolDown(5*time.Second, "a") {
+		t.Error("CoolDown of a cooling down item returned true")
+	}
+	if !c.CoolDown(5*time.Second, "b") {
+		t.Error("CoolDown of another item returned false")
+	}
+
+	clock.Advance(4 * time.Second)
+	if c.CoolDown(5*time.Second, "a") {
+		t.Error("CoolDown before expiry returned true")
+	}
+	clock.Advance(time.Second)
+	if !c.CoolDown(5*time.Second, "a") {
+		t.Error("CoolDown after expiry returned false")
+	}
+	if got := clock.Timers(); got != 1 {
+		t.Errorf("pending timers = %d, want 1", got)
+	}
+}
+
+func TestCoolDownLateTimer(t *testing.T) {
+	c, clock := newTestCounter()
+
+	c.CoolDown(5*time.Second, "a")
+	c.RemoveCoolDown("a")
+	c.CoolDown(10*time.Second, "a")
+	// The timer of the first cooldown is stopped, so it must not cut the second one short.
+	clock.Advance(5 * time.Second)
+	if c.CoolDown(10*time.Second, "a") {
+		t.Error("the second cooldown was removed by the timer of the first one")
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	c, clock := newTestCounter()
+
+	if got := c.Remaining("a"); got != 0 {
+		t.Errorf("Remaining of an unknown item = %v, want 0", got)
+	}
+	c.CoolDown(5*time.Second, "a")
+	clock.Advance(2 * time.Second)
+	if got := c.Remaining("a"); got != 3*time.Second {
+		t.Errorf("Remaining = %v, want 3s", got)
+	}
+	clock.Advance(3 * time.Second)
+	if got := c.Remaining("a"); got != 0 {
+		t.Errorf("Remaining after expiry = %v, want 0", got)
+	}
+}
+
+func TestRemoveCoolDown(t *testing.T) {
+	c, clock := newTestCounter()
+
+	c.RemoveCoolDown("a")
+	c.CoolDown(5*time.Second, "a")
+	c.RemoveCoolDown("a")
+	if got := clock.Timers(); got != 0 {
+		t.Errorf("pending timers after RemoveCoolDown = %d, want 0", got)
+	}
+	if got := c.Remaining("a"); got != 0 {
+		t.Errorf("Remaining after RemoveCoolDown = %v, want 0", got)
+	}
+	if !c.CoolDown(5*time.Second, "a") {
+		t.Error("CoolDown after RemoveCoolDown returned false")
+	}
+}
+
+func TestClose(t *testing.T) {
+	c, clock := newTestCounter()
+
+	c.CoolDown(5*time.Second, "a")
+	c.Close()
+	if got := clock.Timers(); got != 0 {
+		t.Errorf("pending timers after Close = %d, want 0", got)
+	}
+	if got := c.Remaining("a"); got != 0 {
+		t.Errorf("Remaining after Close = %v, want 0", got)
+	}
+	if c.CoolDown(5*time.Second, "b") {
+		t.Error("CoolDown after Close returned true")
+	}
+	if got := clock.Timers(); got != 0 {
+		t.Errorf("CoolDown after Close started %d timers", got)
+	}
+}
@@ -0,0 +1,13 @@
+package utils
+
+// The exports for the tests in utils_test, which cannot be in this package
+// since they use internal/clocktest, which imports this package.
+
+const SweepInterval = sweepInterval
+
+func HasBucket(r *RateLimiter, key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.buckets[key]
+	return ok
+}
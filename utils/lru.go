@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+)
+
+type lruEntry[V any] struct {
+	key  string
+	val  V
+	size int
+}
+
+// LRUCache is a cache bounded by the total size of the values.
+// The least recently used values are evicted first when the cache is full.
+type LRUCache[V any] struct {
+	mu      sync.Mutex
+	maxSize int
+	size    int
+	order   *list.List
+	items   map[string]*list.Element
+}
+
+func NewLRUCache[V any](maxSize int) *LRUCache[V] {
+	return &LRUCache[V]{
+		maxSize: maxSize,
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value of key and marks it as recently used.
+func (c *LRUCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry[V]).val, true
+}
+
+// Add puts the value of key into the cache. size is the cost of the value.
+// Values larger than the whole cache are not cached.
+func (c *LRUCache[V]) Add(key string, val V, size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if size > c.maxSize {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+	c.items[key] = c.order.PushFront(&lruEntry[V]{key: key, val: val, size: size})
+	c.size += size
+	for c.size > c.maxSize {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *LRUCache[V]) removeElement(e *list.Element) {
+	ent := c.order.Remove(e).(*lruEntry[V])
+	delete(c.items, ent.key)
+	c.size -= ent.size
+}
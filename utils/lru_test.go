@@ -0,0 +1,70 @@
+package utils_test
+
+import (
+	"testing"
+
+	"discordsticker/utils"
+)
+
+// cached returns the keys in the cache, checking their values are the keys themselves.
+func cached(t *testing.T, c *utils.LRUCache[string], keys ...string) []string {
+	t.Helper()
+	var ret []string
+	for _, k := range keys {
+		if v, ok := c.Get(k); ok {
+			if v != k {
+				t.Errorf("Get(%q) = %q", k, v)
+			}
+			ret = append(ret, k)
+		}
+	}
+	return ret
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := utils.NewLRUCache[string](3)
+	c.Add("a", "a", 1)
+	c.Add("b", "b", 1)
+	c.Add("c", "c", 1)
+	// Using a makes b the least recently used one.
+	c.Get("a")
+	c.Add("d", "d", 1)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b was not evicted")
+	}
+	if got := cached(t, c, "a", "c", "d"); len(got) != 3 {
+		t.Errorf("cached = %v, want a, c and d", got)
+	}
+}
+
+func TestLRUCacheUpdate(t *testing.T) {
+	c := utils.NewLRUCache[string](3)
+	c.Add("a", "old", 2)
+	c.Add("a", "a", 1)
+	c.Add("b", "b", 2)
+
+	// The size of the old value is not counted anymore, so nothing is evicted.
+	if got := cached(t, c, "a", "b"); len(got) != 2 {
+		t.Errorf("cached = %v, want a and b", got)
+	}
+}
+
+func TestLRUCacheCapacity(t *testing.T) {
+	c := utils.NewLRUCache[string](3)
+	c.Add("a", "a", 1)
+	c.Add("huge", "huge", 4)
+	if _, ok := c.Get("huge"); ok {
+		t.Error("a value larger than the cache was cached")
+	}
+	if got := cached(t, c, "a"); len(got) != 1 {
+		t.Error("adding a value larger than the cache evicted the others")
+	}
+
+	// A large value evicts as many values as needed.
+	c.Add("b", "b", 1)
+	c.Add("c", "c", 3)
+	if got := cached(t, c, "a", "b", "c"); len(got) != 1 || got[0] != "c" {
+		t.Errorf("cached = %v, want c only", got)
+	}
+}
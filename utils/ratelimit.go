@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often RateLimiter looks for idle buckets.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket is refilled completely, after which it can be evicted.
+	full time.Time
+}
+
+// RateLimiter is a token bucket rate limiter with a bucket per key.
+// Every bucket holds up to burst tokens and gains one token every interval;
+// An action takes one token. The rate and the burst are given on every call,
+// so one RateLimiter can serve keys with different limits.
+// Buckets refilled completely are evicted, since a new bucket starts full anyway.
+type RateLimiter struct {
+	mu        sync.Mutex
+	clock     Clock
+	buckets   map[interface{}]*bucket
+	lastSweep time.Time
+}
+
+func NewRateLimiter(clock Clock) *RateLimiter {
+	return &RateLimiter{
+		clock:     clock,
+		buckets:   make(map[interface{}]*bucket),
+		lastSweep: clock.Now(),
+	}
+}
+
+// tokensAt returns the tokens b would have at now, without changing b.
+func (b *bucket) tokensAt(now time.Time, interval time.Duration, burst int) float64 {
+	return min(b.tokens+float64(now.Sub(b.last))/float64(interval), float64(burst))
+}
+
+// refill adds the tokens gained since the last call to b.
+func (b *bucket) refill(now time.Time, interval time.Duration, burst int) {
+	b.tokens = b.tokensAt(now, interval, burst)
+	b.last = now
+	b.full = now.Add(time.Duration((float64(burst) - b.tokens) * float64(interval)))
+}
+
+// Allow takes a token from the bucket of key, which gains a token every interval and holds up to burst tokens.
+// It returns false if the bucket is empty.
+func (r *RateLimiter) Allow(key interface{}, interval time.Duration, burst int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	r.sweep(now)
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		r.buckets[key] = b
+	}
+	b.refill(now, interval, burst)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	b.refill(now, interval, burst)
+	return true
+}
+
+// Refund gives back a token taken by Allow, e.g. when the action is not done after all.
+func (r *RateLimiter) Refund(key interface{}, interval time.Duration, burst int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.buckets[key]
+	if !ok {
+		return
+	}
+	now := r.clock.Now()
+	b.refill(now, interval, burst)
+	b.tokens++
+	b.refill(now, interval, burst)
+}
+
+// Remaining returns how long until the bucket of key has a token, or 0 if it has one now.
+func (r *RateLimiter) Remaining(key interface{}, interval time.Duration, burst int) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.buckets[key]
+	if !ok {
+		return 0
+	}
+	tokens := b.tokensAt(r.clock.Now(), interval, burst)
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) * float64(interval))
+}
+
+// sweep evicts the full buckets at most once every sweepInterval. The caller must hold r.mu.
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < sweepInterval {
+		return
+	}
+	r.lastSweep = now
+	for key, b := range r.buckets {
+		if !now.Before(b.full) {
+			delete(r.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"discordsticker/internal/clocktest"
+	"discordsticker/utils"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := clocktest.NewClock(time.Unix(0, 0))
+	r := utils.NewRateLimiter(clock)
+	const interval, burst = 10 * time.Second, 3
+
+	for i := 0; i < burst; i++ {
+		if !r.Allow("a", interval, burst) {
+			t.Fatalf("Allow #%d within the burst returned false", i)
+		}
+	}
+	if r.Allow("a", interval, burst) {
+		t.Error("Allow beyond the burst returned true")
+	}
+	if !r.Allow("b", interval, burst) {
+		t.Error("Allow of another key returned false")
+	}
+
+	clock.Advance(4 * time.Second)
+	if got := r.Remaining("a", interval, burst); got != 6*time.Second {
+		t.Errorf("Remaining = %v, want 6s", got)
+	}
+	// Remaining must not change the bucket.
+	if got := r.Remaining("a", interval, burst); got != 6*time.Second {
+		t.Errorf("second Remaining = %v, want 6s", got)
+	}
+	clock.Advance(6 * time.Second)
+	if got := r.Remaining("a", interval, burst); got != 0 {
+		t.Errorf("Remaining with a token = %v, want 0", got)
+	}
+	if !r.Allow("a", interval, burst) {
+		t.Error("Allow after a refill returned false")
+	}
+	if r.Allow("a", interval, burst) {
+		t.Error("Allow took more tokens than refilled")
+	}
+}
+
+func TestRateLimiterRefund(t *testing.T) {
+	clock := clocktest.NewClock(time.Unix(0, 0))
+	r := utils.NewRateLimiter(clock)
+	const interval, burst = time.Minute, 1
+
+	r.Refund("a", interval, burst)
+	if !r.Allow("a", interval, burst) {
+		t.Fatal("Allow returned false on a new bucket")
+	}
+	r.Refund("a", interval, burst)
+	if !r.Allow("a", interval, burst) {
+		t.Error("Allow after Refund returned false")
+	}
+	r.Refund("a", interval, burst)
+	r.Refund("a", interval, burst)
+	r.Allow("a", interval, burst)
+	if r.Allow("a", interval, burst) {
+		t.Error("Refund filled the bucket over the burst")
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	clock := clocktest.NewClock(time.Unix(0, 0))
+	r := utils.NewRateLimiter(clock)
+
+	r.Allow("a", time.Second, 1)
+	clock.Advance(utils.SweepInterval)
+	r.Allow("b", time.Second, 1)
+	if utils.HasBucket(r, "a") {
+		t.Error("the full bucket of a was not evicted")
+	}
+	if !utils.HasBucket(r, "b") {
+		t.Error("the bucket of b was evicted")
+	}
+}